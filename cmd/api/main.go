@@ -2,21 +2,36 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"os"
 
 	"github.com/MrPuls/groceries-price-aggregator-go/internal/api"
 	"github.com/MrPuls/groceries-price-aggregator-go/internal/db"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/logging"
 )
 
 func main() {
+	if err := logging.SetupFromEnv(); err != nil {
+		fatal("invalid logging options", err)
+	}
+
 	ctx := context.Background()
 
 	database, err := db.NewDB(ctx)
 	if err != nil {
-		log.Fatal(err)
+		fatal("failed to connect to DB", err)
 	}
 	defer database.Pool.Close()
 
 	server := api.NewServer(8080, database)
-	server.Start()
+	if err := server.Start(); err != nil {
+		database.Pool.Close()
+		fatal("server stopped", err)
+	}
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
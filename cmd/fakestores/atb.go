@@ -0,0 +1,99 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const atbPageSize = 24
+
+var atbHomeTemplate = template.Must(template.New("home").Parse(`<!DOCTYPE html>
+<html lang="uk">
+<head><title>АТБ</title></head>
+<body>
+<ul class="category-menu">
+{{- range .}}
+  <li class="category-menu__item"><a href="/catalog/{{.Slug}}">{{.Name}}</a>
+    <ul class="category-menu__submenu">
+    {{- range .Categories}}
+      <li class="category-menu__item"><a href="/catalog/{{.Slug}}">{{.Name}}</a></li>
+    {{- end}}
+    </ul>
+  </li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+var atbCatalogTemplate = template.Must(template.New("catalog").Funcs(template.FuncMap{
+	"comma": func(price float64) string {
+		return strings.Replace(formatPrice(price), ".", ",", 1)
+	},
+	"dot": formatPrice,
+}).Parse(`<!DOCTYPE html>
+<html lang="uk">
+<head><title>{{.Category.Name}}</title></head>
+<body>
+<h1 class="page-title">{{.Category.Name}}</h1>
+<div class="catalog-list">
+{{- range .Products}}
+  <article class="catalog-item">
+    <div class="catalog-item__photo"><img class="catalog-item__img" src="/images/{{.Slug}}.jpg" alt="{{.Name}}"></div>
+    <div class="catalog-item__title"><a href="/product/{{.Slug}}">{{.Name}}</a></div>
+    <div class="catalog-item__bottom">
+      <data class="product-price__top" value="{{dot .Price}}"><span>{{comma .Price}}</span><abbr class="product-price__currency-abbr">грн/{{.Unit}}</abbr></data>
+      {{- if .OldPrice}}
+      <data class="product-price__bottom" value="{{dot .OldPrice}}"><span>{{comma .OldPrice}}</span></data>
+      {{- end}}
+    </div>
+  </article>
+{{- end}}
+</div>
+{{- if gt .Pages 1}}
+<ul class="product-pagination__list">
+{{- range .PageNumbers}}
+  <li class="product-pagination__item{{if eq . $.Page}} active{{end}}"><a href="?page={{.}}">{{.}}</a></li>
+{{- end}}
+  <li class="product-pagination__item next"><a href="?page={{.Page}}">»</a></li>
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+func registerAtb(mux *http.ServeMux, categories []fakeCategory) {
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		renderHTML(w, atbHomeTemplate, departmentTree(categories))
+	})
+
+	mux.HandleFunc("GET /catalog/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		c, ok := findCategory(categories, r.PathValue("slug"))
+		if !ok {
+			notFound(w, "category")
+			return
+		}
+		pages := max((len(c.Products)+atbPageSize-1)/atbPageSize, 1)
+		current := min(max(intParam(r, "page", 1), 1), pages)
+		numbers := make([]int, pages)
+		for i := range numbers {
+			numbers[i] = i + 1
+		}
+		renderHTML(w, atbCatalogTemplate, map[string]any{
+			"Category":    c,
+			"Products":    page(c.Products, (current-1)*atbPageSize, atbPageSize),
+			"Page":        current,
+			"Pages":       pages,
+			"PageNumbers": numbers,
+		})
+	})
+}
+
+func renderHTML(w http.ResponseWriter, t *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, data); err != nil {
+		log.Printf("error rendering %s: %v", t.Name(), err)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+)
+
+// fakeProduct.OldPrice is the regular price of products on sale, Price being
+// the discounted one, and zero otherwise. The promotion ends PromoDays after
+// the day the catalog is served. Stock is the quantity left, zero for sold out
+// products.
+type fakeProduct struct {
+	ID        string
+	Slug      string
+	Name      string
+	Brand     string
+	EAN       string
+	Price     float64
+	OldPrice  float64
+	PromoDays int
+	Stock     float64
+	Unit      string
+	Ratio     string
+}
+
+// description returns an HTML description like the ones stores serve.
+func (p fakeProduct) description() string {
+	return fmt.Sprintf("<p><strong>%s</strong> від виробника %s.</p><p>Зберігати при температурі до +25&deg;C.</p>", p.Name, p.Brand)
+}
+
+// discount returns the promotion discount in whole percent.
+func (p fakeProduct) discount() int {
+	if p.OldPrice == 0 {
+		return 0
+	}
+	return int(math.Round((1 - p.Price/p.OldPrice) * 100))
+}
+
+// promoEnds returns the last day of the promotion as YYYY-MM-DD.
+func (p fakeProduct) promoEnds() string {
+	return time.Now().AddDate(0, 0, p.PromoDays).Format(time.DateOnly)
+}
+
+type fakeCategory struct {
+	ID         int
+	Slug       string
+	Name       string
+	Department fakeDepartment
+	Products   []fakeProduct
+}
+
+// fakeDepartment is a top level category; products live in the categories
+// below it.
+type fakeDepartment struct {
+	ID   int
+	Slug string
+	Name string
+}
+
+// fakeDepartmentTree is a department with its categories.
+type fakeDepartmentTree struct {
+	fakeDepartment
+	Categories []fakeCategory
+}
+
+// Total returns the number of products in the department.
+func (d fakeDepartmentTree) Total() int {
+	var total int
+	for _, c := range d.Categories {
+		total += len(c.Products)
+	}
+	return total
+}
+
+var departments = []fakeDepartment{
+	{ID: 10, Slug: "molochka-khlib-ta-vypichka", Name: "Молочка, хліб та випічка"},
+	{ID: 20, Slug: "svizhi-produkty", Name: "Свіжі продукти"},
+	{ID: 30, Slug: "napoi-ta-alkohol", Name: "Напої та алкоголь"},
+}
+
+type categoryTemplate struct {
+	slug       string
+	name       string
+	department int
+	items      []string
+	sizes      []string
+	unit       string
+}
+
+// Every store gets the same assortment with its own prices, so that the
+// cross-store product matching in the API has something to match.
+var categoryTemplates = []categoryTemplate{
+	{
+		slug:       "molochni-produkty",
+		name:       "Молочні продукти та яйця",
+		department: 0,
+		items:      []string{"Молоко 2,5%", "Молоко 3,2%", "Кефір 1%", "Йогурт полуничний", "Сир кисломолочний 9%", "Сметана 15%", "Масло вершкове 82%"},
+		sizes:      []string{"900г", "1л", "400г", "200г"},
+		unit:       "шт",
+	},
+	{
+		slug:       "khlib-ta-vypichka",
+		name:       "Хліб та випічка",
+		department: 0,
+		items:      []string{"Хліб житній", "Батон нарізний", "Багет французький", "Лаваш тонкий", "Круасан з шоколадом"},
+		sizes:      []string{"350г", "500г", "700г"},
+		unit:       "шт",
+	},
+	{
+		slug:       "ovochi-ta-frukty",
+		name:       "Овочі та фрукти",
+		department: 1,
+		items:      []string{"Банани", "Яблука Голден", "Картопля", "Морква", "Помідори чері", "Огірки", "Цибуля ріпчаста"},
+		sizes:      []string{"1кг"},
+		unit:       "кг",
+	},
+	{
+		slug:       "napoi",
+		name:       "Напої",
+		department: 2,
+		items:      []string{"Вода мінеральна негазована", "Вода мінеральна сильногазована", "Сік апельсиновий", "Сік яблучний", "Квас хлібний"},
+		sizes:      []string{"0,5л", "1л", "1,5л"},
+		unit:       "шт",
+	},
+	{
+		slug:       "miaso-ta-ptytsia",
+		name:       "М'ясо та птиця",
+		department: 1,
+		items:      []string{"Філе куряче", "Стегно куряче", "Фарш свино-яловичий", "Ошийок свинячий"},
+		sizes:      []string{"500г", "1кг"},
+		unit:       "кг",
+	},
+}
+
+var brands = []string{"Яготинське", "Галичина", "Ферма", "Лактонія", "Своя лінія", "Премія", "Наш край"}
+
+// newCatalog generates a deterministic catalog for store with up to
+// perCategory products in each category.
+func newCatalog(store string, perCategory int) []fakeCategory {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(store))
+	rnd := rand.New(rand.NewPCG(h.Sum64(), 42))
+
+	categories := make([]fakeCategory, 0, len(categoryTemplates))
+	for i, t := range categoryTemplates {
+		c := fakeCategory{ID: 100 + i*10, Slug: t.slug, Name: t.name, Department: departments[t.department]}
+	products:
+		for _, brand := range brands {
+			for _, item := range t.items {
+				for _, size := range t.sizes {
+					if len(c.Products) >= perCategory {
+						break products
+					}
+					n := len(c.Products) + 1
+					price := 15 + rnd.Float64()*185
+					p := fakeProduct{
+						ID:    fmt.Sprintf("%d%04d", c.ID, n),
+						Slug:  fmt.Sprintf("%s-%d%04d", t.slug, c.ID, n),
+						Name:  fmt.Sprintf("%s %s %s", item, brand, size),
+						Brand: brand,
+						EAN:   fmt.Sprintf("482%010d", c.ID*10000+n),
+						Price: math.Round(price*100) / 100,
+						Unit:  t.unit,
+						Ratio: size,
+					}
+					// Roughly one product in eight is sold out.
+					if rnd.IntN(8) != 0 {
+						p.Stock = float64(1 + rnd.IntN(199))
+					}
+					// Roughly one product in five is on sale.
+					if rnd.IntN(5) == 0 {
+						p.OldPrice = math.Round(price*(1.1+rnd.Float64()*0.3)*100) / 100
+						p.PromoDays = 1 + rnd.IntN(14)
+					}
+					c.Products = append(c.Products, p)
+				}
+			}
+		}
+		categories = append(categories, c)
+	}
+	return categories
+}
+
+// departmentTree groups categories by department.
+func departmentTree(categories []fakeCategory) []fakeDepartmentTree {
+	tree := make([]fakeDepartmentTree, 0, len(departments))
+	for _, d := range departments {
+		node := fakeDepartmentTree{fakeDepartment: d}
+		for _, c := range categories {
+			if c.Department == d {
+				node.Categories = append(node.Categories, c)
+			}
+		}
+		tree = append(tree, node)
+	}
+	return tree
+}
+
+func findDepartment(slug string) (fakeDepartment, bool) {
+	for _, d := range departments {
+		if d.Slug == slug {
+			return d, true
+		}
+	}
+	return fakeDepartment{}, false
+}
+
+func findCategory(categories []fakeCategory, slug string) (fakeCategory, bool) {
+	for _, c := range categories {
+		if c.Slug == slug {
+			return c, true
+		}
+	}
+	return fakeCategory{}, false
+}
+
+// page returns items[offset:offset+limit] clamped to the slice bounds.
+func page[T any](items []T, offset, limit int) []T {
+	if offset < 0 || offset >= len(items) {
+		return nil
+	}
+	return items[offset:min(offset+limit, len(items))]
+}
+
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
+
+// branchPriceFactor makes prices differ between branches by up to ±10%, the
+// default branch being the reference.
+func branchPriceFactor(branch string) float64 {
+	if branch == "" || branch == silpoDefaultBranch || branch == "3" {
+		return 1
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(branch))
+	return 0.9 + float64(h.Sum32()%21)/100
+}
@@ -0,0 +1,60 @@
+// Command fakestores serves a local imitation of the Silpo, zakaz.ua (Metro,
+// Novus, Auchan, ...), Varus and ATB endpoints used by the scrapers, so that a full scraper → DB →
+// API run works without touching the real shops.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8090", "address to listen on")
+	perCategory := flag.Int("products", 120, "number of products per category")
+	flag.Parse()
+
+	mux := http.NewServeMux()
+	registerSilpo(mux, newCatalog("silpo", *perCategory))
+	registerZakaz(mux, *perCategory)
+	registerVarus(mux, newCatalog("varus", *perCategory))
+	registerAtb(mux, newCatalog("atb", *perCategory))
+
+	base := "http://" + *addr
+	log.Printf("Serving fake stores on %s", base)
+	log.Printf("Point the scraper at it with SCRAPER_BASE_URLS=*=%s", base)
+	if err := http.ListenAndServe(*addr, logRequests(mux)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error encoding response: %v", err)
+	}
+}
+
+// intParam returns the integer query parameter name or def if it is missing
+// or malformed.
+func intParam(r *http.Request, name string, def int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func notFound(w http.ResponseWriter, what string) {
+	http.Error(w, fmt.Sprintf("%s not found", what), http.StatusNotFound)
+}
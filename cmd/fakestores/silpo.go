@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"net/http"
+)
+
+const silpoDefaultBranch = "00000000-0000-0000-0000-000000000000"
+
+var silpoBranches = []map[string]any{
+	{"id": "2f2c1e4e-8a4b-4c0e-9a57-1d2b3c4d5e01", "title": "Сільпо, вул. Хрещатик 15", "city": "Київ"},
+	{"id": "2f2c1e4e-8a4b-4c0e-9a57-1d2b3c4d5e02", "title": "Сільпо, просп. Перемоги 24", "city": "Київ"},
+	{"id": "2f2c1e4e-8a4b-4c0e-9a57-1d2b3c4d5e03", "title": "Сільпо, вул. Городоцька 179", "city": "Львів"},
+	{"id": "2f2c1e4e-8a4b-4c0e-9a57-1d2b3c4d5e04", "title": "Сільпо, просп. Яворницького 52", "city": "Дніпро"},
+}
+
+func registerSilpo(mux *http.ServeMux, categories []fakeCategory) {
+	mux.HandleFunc("GET /v1/uk/branches", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"total": len(silpoBranches), "items": silpoBranches})
+	})
+
+	mux.HandleFunc("GET /v1/branches/{branch}/categories/tree", func(w http.ResponseWriter, r *http.Request) {
+		tree := departmentTree(categories)
+		items := make([]map[string]any, 0, len(tree))
+		for _, d := range tree {
+			children := make([]map[string]any, 0, len(d.Categories))
+			for _, c := range d.Categories {
+				children = append(children, map[string]any{"slug": c.Slug, "total": len(c.Products)})
+			}
+			items = append(items, map[string]any{"slug": d.Slug, "total": d.Total(), "children": children})
+		}
+		writeJSON(w, map[string]any{"total": len(items), "items": items})
+	})
+
+	mux.HandleFunc("GET /v1/uk/branches/{branch}/categories/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		if d, ok := findDepartment(r.PathValue("slug")); ok {
+			writeJSON(w, map[string]any{"slug": d.Slug, "categoryName": d.Name})
+			return
+		}
+		c, ok := findCategory(categories, r.PathValue("slug"))
+		if !ok {
+			notFound(w, "category")
+			return
+		}
+		writeJSON(w, map[string]any{"slug": c.Slug, "categoryName": c.Name, "total": len(c.Products)})
+	})
+
+	mux.HandleFunc("GET /v1/uk/branches/{branch}/products", func(w http.ResponseWriter, r *http.Request) {
+		c, ok := findCategory(categories, r.URL.Query().Get("category"))
+		if !ok {
+			notFound(w, "category")
+			return
+		}
+		factor := branchPriceFactor(r.PathValue("branch"))
+		products := page(c.Products, intParam(r, "offset", 0), intParam(r, "limit", 100))
+		items := make([]map[string]any, 0, len(products))
+		for _, p := range products {
+			var oldPrice any
+			if p.OldPrice > 0 {
+				oldPrice = math.Round(p.OldPrice*factor*100) / 100
+			}
+			items = append(items, map[string]any{
+				"id":                p.ID,
+				"title":             p.Name,
+				"slug":              p.Slug,
+				"externalProductId": p.ID,
+				"brandTitle":        p.Brand,
+				"barcode":           p.EAN,
+				"icon":              p.Slug + ".png",
+				"displayPrice":      math.Round(p.Price*factor*100) / 100,
+				"displayOldPrice":   oldPrice,
+				"displayRatio":      p.Ratio,
+				"stock":             p.Stock,
+			})
+		}
+		writeJSON(w, map[string]any{"total": len(c.Products), "items": items})
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+const varusRootCategory = 2
+
+// varusMaxCategories caps the categories served per request, below what the
+// scraper asks for, so that it has to page through them.
+const varusMaxCategories = 4
+
+func registerVarus(mux *http.ServeMux, categories []fakeCategory) {
+	// Categories are listed flat, departments hanging off the store root.
+	mux.HandleFunc("GET /api/catalog/vue_storefront_catalog_2/category/_search", func(w http.ResponseWriter, r *http.Request) {
+		var hits []map[string]any
+		for _, d := range departmentTree(categories) {
+			hits = append(hits, map[string]any{"id": d.ID, "parent_id": varusRootCategory, "name": d.Name, "url_path": d.Slug})
+			for _, c := range d.Categories {
+				hits = append(hits, map[string]any{"id": c.ID, "parent_id": d.ID, "name": c.Name, "url_path": d.Slug + "/" + c.Slug})
+			}
+		}
+		found := page(hits, intParam(r, "from", 0), min(intParam(r, "size", 10), varusMaxCategories))
+		writeJSON(w, map[string]any{"total": map[string]any{"value": len(hits)}, "hits": found})
+	})
+
+	mux.HandleFunc("GET /api/catalog/vue_storefront_catalog_2/product_v2/_search", func(w http.ResponseWriter, r *http.Request) {
+		var products []fakeProduct
+		ids := varusCategoryIDs(r.URL.Query().Get("request"))
+		for _, c := range categories {
+			if slices.Contains(ids, c.ID) {
+				products = append(products, c.Products...)
+			}
+		}
+		shop := r.URL.Query().Get("shop_id")
+		factor := branchPriceFactor(shop)
+		found := page(products, intParam(r, "from", 0), intParam(r, "size", 100))
+		hits := make([]map[string]any, 0, len(found))
+		for _, p := range found {
+			hit := map[string]any{
+				"sku":                      p.ID,
+				"name":                     p.Name,
+				"url_key":                  p.Slug,
+				"brand_data":               map[string]any{"name": p.Brand},
+				"image":                    "/" + p.Slug + ".jpg",
+				"description":              p.description(),
+				"productquantityunit":      p.Unit,
+				"wghweigh":                 p.Unit == "кг",
+				"regular_price":            p.Price,
+				"stock":                    map[string]any{"is_in_stock": p.Stock > 0, "qty": p.Stock},
+				"sqpp_data_region_default": map[string]any{"price": p.Price, "in_stock": p.Stock > 0},
+				"sqpp_data_" + shop:        map[string]any{"price": math.Round(p.Price*factor*100) / 100, "in_stock": p.Stock > 0},
+			}
+			if p.OldPrice > 0 {
+				hit["regular_price"] = p.OldPrice
+				hit["special_price_discount"] = strconv.Itoa(p.discount())
+				hit["special_price_to_date"] = p.promoEnds() + " 23:59:59"
+			}
+			hits = append(hits, hit)
+		}
+		writeJSON(w, map[string]any{"total": map[string]any{"value": len(products)}, "hits": hits})
+	})
+}
+
+// varusCategoryIDs extracts the category_ids filter from the search request
+// sent by the scraper.
+func varusCategoryIDs(request string) []int {
+	var query struct {
+		AppliedFilters []struct {
+			Attribute string `json:"attribute"`
+			Value     struct {
+				In []int `json:"in"`
+			} `json:"value"`
+		} `json:"_appliedFilters"`
+	}
+	if err := json.Unmarshal([]byte(request), &query); err != nil {
+		return nil
+	}
+	for _, f := range query.AppliedFilters {
+		if f.Attribute == "category_ids" {
+			return f.Value.In
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+)
+
+const zakazPageSize = 30
+
+// registerZakaz serves every store id asked for, each with its own catalog.
+func registerZakaz(mux *http.ServeMux, perCategory int) {
+	var mu sync.Mutex
+	catalogs := make(map[string][]fakeCategory)
+	catalogFor := func(store string) []fakeCategory {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := catalogs[store]; !ok {
+			catalogs[store] = newCatalog("zakaz-"+store, perCategory)
+		}
+		return catalogs[store]
+	}
+
+	mux.HandleFunc("GET /stores/{store}/categories", func(w http.ResponseWriter, r *http.Request) {
+		tree := departmentTree(catalogFor(r.PathValue("store")))
+		items := make([]map[string]any, 0, len(tree))
+		for _, d := range tree {
+			children := make([]map[string]any, 0, len(d.Categories))
+			for _, c := range d.Categories {
+				children = append(children, map[string]any{"id": c.Slug, "title": c.Name, "count": len(c.Products)})
+			}
+			items = append(items, map[string]any{"id": d.Slug, "title": d.Name, "count": d.Total(), "children": children})
+		}
+		writeJSON(w, items)
+	})
+
+	mux.HandleFunc("GET /stores/{store}/categories/{slug}/products", func(w http.ResponseWriter, r *http.Request) {
+		c, ok := findCategory(catalogFor(r.PathValue("store")), r.PathValue("slug"))
+		if !ok {
+			notFound(w, "category")
+			return
+		}
+		pageNum := max(intParam(r, "page", 1), 1)
+		products := page(c.Products, (pageNum-1)*zakazPageSize, zakazPageSize)
+		results := make([]map[string]any, 0, len(products))
+		for _, p := range products {
+			results = append(results, map[string]any{
+				"sku":      p.ID,
+				"title":    p.Name,
+				"price":    math.Round(p.Price * 100),
+				"unit":     zakazUnit(p.Unit),
+				"in_stock": p.Stock > 0,
+				"ean":      p.EAN,
+				"img":      map[string]any{"s350x350": fmt.Sprintf("https://img2.zakaz.ua/%s/s350x350.jpg", p.Slug)},
+				"producer": map[string]any{"trademark": p.Brand},
+				"web_url":  fmt.Sprintf("https://zakaz.ua/uk/products/%s--%s/", r.PathValue("store"), p.Slug),
+				"discount": map[string]any{
+					"status":    p.OldPrice > 0,
+					"value":     p.discount(),
+					"old_price": math.Round(p.OldPrice * 100),
+					"due_date":  zakazDueDate(p),
+				},
+			})
+		}
+		writeJSON(w, map[string]any{"count": len(c.Products), "results": results})
+	})
+}
+
+func zakazDueDate(p fakeProduct) any {
+	if p.OldPrice == 0 {
+		return nil
+	}
+	return p.promoEnds()
+}
+
+func zakazUnit(unit string) string {
+	if unit == "кг" {
+		return "kg"
+	}
+	return "pcs"
+}
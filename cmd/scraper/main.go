@@ -1,31 +1,457 @@
 package main
 
 import (
+	"cmp"
 	"context"
-	"log"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/MrPuls/groceries-price-aggregator-go/cmd/scraper/runner"
+	"github.com/MrPuls/groceries-price-aggregator-go/cmd/scraper/scheduler"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/db"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/httpclient"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/logging"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/metrics"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/models"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/scrapers"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/sink"
 )
 
+const usage = `Usage: scraper [command] [flags]
+
+Commands:
+  run      scrape the stores and import the products into the database (default)
+  import   import files written by an earlier run into the database
+  serve    scrape the stores on a schedule until stopped
+  stores   list the stores that can be scraped
+
+Run "scraper <command> -h" for the flags of a command.
+`
+
 func main() {
-	log.Println("Starting main program")
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(5*time.Minute))
+	cmd, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "run":
+		err = runCmd(args)
+	case "import":
+		err = importCmd(args)
+	case "serve":
+		err = serveCmd(args)
+	case "stores":
+		err = storesCmd(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		slog.Error(cmd+" failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	stores := fs.String("stores", "", `comma separated codes of the stores to scrape, all when empty; see "scraper stores"`)
+	timeout := fs.Duration("timeout", 5*time.Minute, "give up scraping and importing after this long, 0 for no limit")
+	outputDir := fs.String("output-dir", ".", "directory to write the scraped products to")
+	format := fs.String("format", sink.FormatCSV, "comma separated outputs of the scraped products, any of csv, ndjson, csv.gz, ndjson.gz and stdout")
+	noDB := fs.Bool("no-db", false, "only write the products to files, without tracking the run or importing it into the database")
+	dryRun := fs.Bool("dry-run", false, "scrape and print a summary, without writing files or touching the database")
+	stream := fs.Bool("stream", false, `import products into the database in batches while scraping; files are then only kept as archives, -format "" writes none`)
+	batchSize := fs.Int("batch-size", runner.DefaultBatchSize, "number of products imported at once with -stream")
+	chaos := fs.String("chaos", "", `inject faults into store requests: "default" or e.g. "latency=1s,reset=0.05,status=0.1,html=0.05,truncate=0.05"`)
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this address while scraping, e.g. :9100")
+	pushgateway := fs.String("pushgateway", "", "push metrics to the Prometheus Pushgateway at this URL once scraping is done")
+	setupLogging := logFlags(fs)
+	_ = fs.Parse(args)
+
+	if err := setupLogging(); err != nil {
+		return err
+	}
+	codes, err := parseStores(*stores)
+	if err != nil {
+		return err
+	}
+	outputs, err := parseOutputs(*format, *stream || *dryRun, !*stream && !*noDB && !*dryRun)
+	if err != nil {
+		return err
+	}
+	if *stream && (*noDB || *dryRun) {
+		return fmt.Errorf("-stream imports into the database and cannot be used with -no-db or -dry-run")
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("invalid batch size %d", *batchSize)
+	}
+	if !*dryRun {
+		if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	opts, err := scraperOptions(*chaos)
+	if err != nil {
+		return err
+	}
+	if *metricsAddr != "" {
+		metrics.Serve(*metricsAddr)
+	}
+
+	ctx, cancel := withTimeout(*timeout)
 	defer cancel()
-	r := runner.NewRunner(ctx)
+	r := runner.NewRunner(ctx, opts)
+	r.Stores = codes
+	r.OutputDir = *outputDir
+	r.Outputs = outputs
+	r.DryRun = *dryRun
+	r.Stream = *stream
+	r.BatchSize = *batchSize
+
+	useDB := !*noDB && !*dryRun
+	var dbErr error
+	if useDB {
+		// Connect up front so the run is tracked while it progresses; without
+		// a database the products are still written to files.
+		r.DB, dbErr = r.ConnectToDB(ctx)
+		if dbErr != nil {
+			slog.Error("failed to connect to DB, the scrape run will not be tracked", "error", dbErr)
+		} else {
+			defer r.DB.Pool.Close()
+		}
+	}
+
+	slog.Info("starting scrape", "stores", cmp.Or(*stores, "all"), "dry_run", r.DryRun)
 	r.Run()
-	log.Println("All scrapers are done!")
+	slog.Info("all scrapers are done")
+	if *pushgateway != "" {
+		if err := metrics.Push(*pushgateway, "scraper"); err != nil {
+			slog.Error("failed to push metrics", "error", err)
+		}
+	}
+
+	if *dryRun {
+		printSummary(os.Stdout, r.ScrapeRun)
+		return nil
+	}
+	if !useDB {
+		return nil
+	}
+	if dbErr != nil {
+		return fmt.Errorf("failed to connect to DB: %w", dbErr)
+	}
+	if len(r.Files) == 0 {
+		slog.Warn("no files to import")
+		return nil
+	}
+	slog.Info("importing products", "files", len(r.Files))
+	if err := r.Import(ctx, r.DB, r.Files); err != nil {
+		return err
+	}
+	slog.Info("products imported successfully")
+	return nil
+}
+
+func importCmd(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: scraper import [flags] file...\n\nImports CSV (.csv) or NDJSON (.ndjson) files written by scraper run.\n\n")
+		fs.PrintDefaults()
+	}
+	timeout := fs.Duration("timeout", 5*time.Minute, "give up importing after this long, 0 for no limit")
+	setupLogging := logFlags(fs)
+	_ = fs.Parse(args)
+
+	if err := setupLogging(); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := withTimeout(*timeout)
+	defer cancel()
+	r := runner.NewRunner(ctx, scrapers.Options{})
+	database, err := r.ConnectToDB(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to DB: %w", err)
+	}
+	defer database.Pool.Close()
 
-	log.Println("Writing CSV data")
-	db, err := r.ConnectToDB(ctx)
+	slog.Info("importing products", "files", fs.NArg())
+	if err := r.Import(ctx, database, fs.Args()); err != nil {
+		return err
+	}
+	slog.Info("products imported successfully")
+	return nil
+}
+
+func serveCmd(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	schedule := fs.String("schedule", os.Getenv("SCRAPER_SCHEDULE"), `semicolon separated store=cron entries, "*" for every other store, e.g. "*=0 3 * * *;silpo=0 */6 * * *"`)
+	jitter := fs.Duration("jitter", 0, "delay every run by a random duration up to this long")
+	missed := fs.String("missed", string(scheduler.MissedSkip), "what to do with runs missed while the previous run was in progress or the scheduler was down: skip or run-once")
+	timeout := fs.Duration("timeout", 30*time.Minute, "cancel a run after this long, 0 for no limit")
+	shutdownTimeout := fs.Duration("shutdown-timeout", time.Minute, "on SIGTERM, wait this long for runs in progress before cancelling them")
+	outputDir := fs.String("output-dir", ".", "directory to write the scraped products to")
+	format := fs.String("format", sink.FormatCSV, "comma separated outputs of the scraped products, any of csv, ndjson, csv.gz, ndjson.gz and stdout")
+	noDB := fs.Bool("no-db", false, "only write the products to files, without locking stores, tracking runs or importing them into the database")
+	stream := fs.Bool("stream", false, `import products into the database in batches while scraping; files are then only kept as archives, -format "" writes none`)
+	batchSize := fs.Int("batch-size", runner.DefaultBatchSize, "number of products imported at once with -stream")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9100")
+	setupLogging := logFlags(fs)
+	_ = fs.Parse(args)
+
+	if err := setupLogging(); err != nil {
+		return err
+	}
+	if *schedule == "" {
+		return fmt.Errorf("no schedule: set -schedule or SCRAPER_SCHEDULE")
+	}
+	jobs, err := scheduler.ParseJobs(*schedule)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer db.Pool.Close()
+	policy, err := scheduler.ParseMissedPolicy(*missed)
+	if err != nil {
+		return err
+	}
+	outputs, err := parseOutputs(*format, *stream, !*stream && !*noDB)
+	if err != nil {
+		return err
+	}
+	if *stream && *noDB {
+		return fmt.Errorf("-stream imports into the database and cannot be used with -no-db")
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("invalid batch size %d", *batchSize)
+	}
+	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	opts, err := scraperOptions("")
+	if err != nil {
+		return err
+	}
+	if *metricsAddr != "" {
+		metrics.Serve(*metricsAddr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var database *db.DB
+	if !*noDB {
+		database, err = db.NewDB(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to connect to DB: %w", err)
+		}
+		defer database.Pool.Close()
+	}
+
+	s := &scheduler.Scheduler{
+		Jobs:            jobs,
+		Jitter:          *jitter,
+		Missed:          policy,
+		Timeout:         *timeout,
+		ShutdownTimeout: *shutdownTimeout,
+		DB:              database,
+		NewRunner: func(ctx context.Context) *runner.Runner {
+			r := runner.NewRunner(ctx, opts)
+			r.DB = database
+			r.OutputDir = *outputDir
+			r.Outputs = outputs
+			r.Stream = *stream
+			r.BatchSize = *batchSize
+			return r
+		},
+	}
+	slog.Info("starting scheduler", "stores", len(jobs), "missed", policy)
+	s.Run(ctx)
+	slog.Info("scheduler stopped")
+	return nil
+}
+
+func storesCmd(args []string) error {
+	fs := flag.NewFlagSet("stores", flag.ExitOnError)
+	_ = fs.Parse(args)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CODE\tNAME")
+	for _, code := range scrapers.Codes() {
+		s, err := scrapers.New(code, scrapers.Options{})
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", code, s.Name())
+	}
+	return w.Flush()
+}
+
+// logFlags adds the logging flags, defaulting to LOG_LEVEL and LOG_FORMAT, to
+// fs. The returned function sets up logging once fs is parsed.
+func logFlags(fs *flag.FlagSet) func() error {
+	level := fs.String("log-level", os.Getenv("LOG_LEVEL"), "minimum level of log records: debug, info, warn or error")
+	format := fs.String("log-format", os.Getenv("LOG_FORMAT"), "log output format: text or json")
+	return func() error {
+		return logging.Setup(*level, *format)
+	}
+}
+
+func withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// scraperOptions builds the scraper options from the SCRAPER_* environment
+// variables and the -chaos flag.
+func scraperOptions(chaos string) (scrapers.Options, error) {
+	var opts scrapers.Options
+	if v := os.Getenv("SCRAPER_RATE_LIMITS"); v != "" {
+		limits, err := httpclient.ParseRateLimits(v)
+		if err != nil {
+			return opts, err
+		}
+		for host, l := range limits {
+			httpclient.SetRateLimit(host, l)
+		}
+	}
+	if v := os.Getenv("SCRAPER_BASE_URLS"); v != "" {
+		baseURLs, err := parseBaseURLs(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.BaseURLs = baseURLs
+	}
+	if v := os.Getenv("SCRAPER_BRANCHES"); v != "" {
+		branches, err := parseBranches(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Branches = branches
+		// Reject branches a store cannot scrape before any run starts.
+		if _, err := scrapers.All(opts); err != nil {
+			return opts, fmt.Errorf("invalid SCRAPER_BRANCHES: %w", err)
+		}
+	}
+	if dir := os.Getenv("SCRAPER_REPLAY_DIR"); dir != "" {
+		slog.Info("replaying store responses", "dir", dir)
+		opts.Transport = &httpclient.Recorder{Dir: dir, Mode: httpclient.ModeReplay}
+	} else if dir := os.Getenv("SCRAPER_RECORD_DIR"); dir != "" {
+		slog.Info("recording store responses", "dir", dir)
+		opts.Transport = &httpclient.Recorder{Dir: dir, Mode: httpclient.ModeRecord, Base: httpclient.NewTransport()}
+	}
+	if chaos != "" {
+		c, err := httpclient.ParseChaos(chaos)
+		if err != nil {
+			return opts, err
+		}
+		c.Base = opts.Transport
+		if c.Base == nil {
+			c.Base = httpclient.NewTransport()
+		}
+		slog.Info("injecting faults into store requests", "chaos", chaos)
+		opts.Transport = c
+	}
+	return opts, nil
+}
+
+// parseOutputs parses the -format flag. No outputs are only allowed when
+// optional, since the products would otherwise go nowhere. needFile requires
+// a file output, for when the products are imported from the files written.
+func parseOutputs(s string, optional, needFile bool) ([]sink.Spec, error) {
+	var outputs []sink.Spec
+	if strings.TrimSpace(s) != "" {
+		var err error
+		if outputs, err = sink.ParseSpecs(s); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case len(outputs) == 0 && !optional:
+		return nil, fmt.Errorf("no output format: without -stream the products only go to files")
+	case needFile && !slices.ContainsFunc(outputs, func(o sink.Spec) bool { return !o.Stdout }):
+		return nil, fmt.Errorf("no file output in %q: products are imported from files unless -stream or -no-db is set", s)
+	}
+	return outputs, nil
+}
+
+// parseStores parses a comma separated list of store codes, e.g.
+// "silpo,metro". An empty list selects every store.
+func parseStores(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var codes []string
+	for _, code := range strings.Split(s, ",") {
+		code = strings.TrimSpace(code)
+		if !slices.Contains(scrapers.Codes(), code) {
+			return nil, fmt.Errorf("unknown store %q: expected one of %s", code, strings.Join(scrapers.Codes(), ", "))
+		}
+		if !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+// printSummary prints the outcome of run per store.
+func printSummary(out io.Writer, run *models.ScrapeRun) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "STORE\tSTATUS\tPRODUCTS\tDUPLICATES\tERRORS\tDURATION")
+	for _, s := range run.Stores {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", s.StoreCode, s.Status, s.Products, s.Duplicates, s.ErrorCount(), s.FinishedAt.Sub(s.StartedAt).Round(time.Second))
+	}
+	_, _ = fmt.Fprintf(w, "total\t%s\t%d\t%d\t%d\t%s\n", run.Status, run.Products(), run.Duplicates(), run.Errors(), run.FinishedAt.Sub(run.StartedAt).Round(time.Second))
+	_ = w.Flush()
+	for _, s := range run.Stores {
+		for _, e := range s.ErrorSamples() {
+			_, _ = fmt.Fprintf(out, "%s: %s\n", s.StoreCode, e)
+		}
+	}
+}
+
+// parseBaseURLs parses a comma separated list of store=url entries, e.g.
+// "silpo=http://localhost:8090,atb=http://localhost:8090". The store "*"
+// matches every store.
+func parseBaseURLs(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		code, u, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || code == "" || u == "" {
+			return nil, fmt.Errorf("invalid base URL %q: expected store=url", entry)
+		}
+		result[code] = u
+	}
+	return result, nil
+}
 
-	wErr := r.WriteCSVData(ctx, db, r.Files)
-	if wErr != nil {
-		log.Fatal(err)
+// parseBranches parses a comma separated list of store:branch entries, where
+// branch is a branch id or a city, e.g. "silpo:Київ,silpo:Львів".
+func parseBranches(s string) (map[string][]string, error) {
+	result := make(map[string][]string)
+	for _, entry := range strings.Split(s, ",") {
+		code, branch, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || code == "" || branch == "" {
+			return nil, fmt.Errorf("invalid branch %q: expected store:branch", entry)
+		}
+		result[code] = append(result[code], branch)
 	}
-	log.Println("CSV data written successfully")
+	return result, nil
 }
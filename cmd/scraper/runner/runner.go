@@ -1,114 +1,339 @@
 package runner
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/MrPuls/groceries-price-aggregator-go/internal/db"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/logging"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/metrics"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/models"
 	"github.com/MrPuls/groceries-price-aggregator-go/internal/scrapers"
-	"github.com/MrPuls/groceries-price-aggregator-go/internal/utils"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/sink"
 )
 
+// DefaultBatchSize is the number of products imported at once when
+// streaming.
+const DefaultBatchSize = 500
+
+// streamFlushInterval bounds how long streamed products wait for their batch
+// to fill up before they are imported anyway.
+const streamFlushInterval = 10 * time.Second
+
+// Runner scrapes Stores once, all registered stores when empty, and writes
+// the products of each store to every one of Outputs as they are scraped,
+// files going to OutputDir. Files are named after the store, the run
+// and its start time, see sink.FileName. In a DryRun nothing is written. The
+// run and its outcome per store are tracked in ScrapeRun and, when DB is set,
+// saved to the database as the scrape progresses.
+//
+// Each product is written as soon as it is first found; the further
+// categories it is listed in follow as relistings, see models.Relisting.
+//
+// With Stream set and a DB, products are also imported into the database in
+// batches of BatchSize as they are scraped; the files written are then only
+// kept as archives and not listed in Files for import.
 type Runner struct {
 	ctx       context.Context
-	csvHeader []string
+	opts      scrapers.Options
+	mu        sync.Mutex
 	Files     []string
+	ScrapeRun *models.ScrapeRun
+	DB        *db.DB
+	Stores    []string
+	OutputDir string
+	Outputs   []sink.Spec
+	DryRun    bool
+	Stream    bool
+	BatchSize int
 }
 
-func NewRunner(ctx context.Context) *Runner {
+func NewRunner(ctx context.Context, opts scrapers.Options) *Runner {
 	return &Runner{
-		ctx:       ctx,
-		csvHeader: []string{"Name", "Ref", "Price", "Category", "Shop"},
-		Files:     []string{},
+		ctx:   ctx,
+		opts:  opts,
+		Files: []string{},
 	}
 }
 
 func (r *Runner) Run() {
+	codes := r.Stores
+	if len(codes) == 0 {
+		codes = scrapers.Codes()
+	}
+	r.ScrapeRun = models.NewScrapeRun(codes)
+	if r.DB != nil {
+		if err := r.DB.StartRun(r.ctx, r.ScrapeRun); err != nil {
+			slog.Error("failed to save scrape run", "error", err)
+		} else {
+			r.ctx = logging.With(r.ctx, "run_id", r.ScrapeRun.ID)
+			logging.FromContext(r.ctx).Info("started scrape run")
+		}
+	}
+
 	var wg sync.WaitGroup
-	defer wg.Wait()
-	wg.Go(r.startSilpoScraper)
-	wg.Go(r.startMetroScraper)
-	wg.Go(r.startVarusScraper)
-	wg.Go(r.startAtbScraper)
-}
+	for _, code := range codes {
+		s, err := scrapers.New(code, r.opts)
+		if err != nil {
+			slog.Error("failed to create scraper", "store", code, "error", err)
+			run := r.ScrapeRun.Store(code)
+			run.AddError(err)
+			run.Finish(0)
+			continue
+		}
+		wg.Go(func() { r.startScraper(s, r.ScrapeRun.Store(code)) })
+	}
+	wg.Wait()
 
-func (r *Runner) startSilpoScraper() {
-	log.Println("Starting Silpo scraper")
-	slp := scrapers.NewSilpoScraper()
-	cts, err := slp.GetCategories(r.ctx)
-	if err != nil {
-		fmt.Printf("[Silpo] error getting categories: %v", err)
+	r.ScrapeRun.Finish()
+	metrics.RunDuration.Observe(r.ScrapeRun.FinishedAt.Sub(r.ScrapeRun.StartedAt).Seconds())
+	metrics.LastRunTimestamp.Set(float64(r.ScrapeRun.FinishedAt.Unix()))
+	logger := logging.FromContext(r.ctx)
+	logger.Info("scrape run finished", "status", r.ScrapeRun.Status, "products", r.ScrapeRun.Products(), "duplicates", r.ScrapeRun.Duplicates(), "errors", r.ScrapeRun.Errors())
+	if r.DB != nil && r.ScrapeRun.ID != 0 {
+		// The outcome is saved even when the scrape was cancelled.
+		if err := r.DB.FinishRun(context.WithoutCancel(r.ctx), r.ScrapeRun); err != nil {
+			logger.Error("failed to save scrape run", "error", err)
+		}
 	}
-	products, err := slp.GetProducts(r.ctx, cts.Items)
-	if err != nil {
-		fmt.Printf("[Silpo] error getting products: %v", err)
+}
+
+func (r *Runner) startScraper(s scrapers.Scraper, run *models.StoreRun) {
+	ctx := logging.With(r.ctx, "store", s.Code())
+	logger := logging.FromContext(ctx)
+	if r.DB != nil {
+		unlock, ok, err := r.DB.TryLockStore(ctx, s.Code())
+		switch {
+		case err != nil:
+			logger.Warn("failed to lock store, scraping it anyway", "error", err)
+		case !ok:
+			logger.Warn("store is being scraped by another run, skipping it")
+			run.Skip()
+			r.saveStore(ctx, run)
+			return
+		default:
+			defer unlock()
+		}
 	}
-	filename, err := utils.WriteToCsv("silpo", r.csvHeader, products)
+	logger.Info("starting scraper")
+	run.Start()
+	defer r.finishStore(ctx, run)
+
+	ctx = scrapers.WithFailureRecorder(metrics.WithStore(ctx, s.Code()), run)
+	cts, err := s.GetCategories(ctx)
 	if err != nil {
-		fmt.Printf("[Silpo] error writing to csv: %v", err)
+		logger.Error("error getting categories", "error", err)
+		run.AddError(fmt.Errorf("error getting categories: %w", err))
+		return
 	}
-	r.Files = append(r.Files, filename)
+	r.scrapeProducts(ctx, s, cts, run)
 }
 
-func (r *Runner) startMetroScraper() {
-	log.Println("Starting Metro scraper")
-	mt := scrapers.NewMetroScraper()
-	cts, err := mt.GetCategories(r.ctx)
-	if err != nil {
-		fmt.Printf("[Metro] error getting categories: %v", err)
+// scrapeProducts scrapes the products of s, merging the listings of products
+// already scraped into the first one, and hands them to the store's sinks.
+//
+// When streaming, products go to the sinks and are imported into the
+// database as they are scraped. Only a batch is held in memory at a time,
+// and a partial batch is imported after streamFlushInterval so that a slow
+// store is saved as it goes. Products listed again in another category are
+// linked to it along with the next batch. Otherwise products are held until
+// the scrape is done so that every category they are listed in goes with
+// them.
+//
+// run.Products counts the products imported when streaming and those scraped
+// otherwise; run.Duplicates counts the listings merged.
+func (r *Runner) scrapeProducts(ctx context.Context, s scrapers.Scraper, cts []scrapers.Category, run *models.StoreRun) {
+	logger := logging.FromContext(ctx)
+	stream := r.Stream && r.DB != nil
+	size := cmp.Or(r.BatchSize, DefaultBatchSize)
+	var (
+		since    time.Time
+		sinceErr error
+	)
+	if stream {
+		since, sinceErr = r.DB.Now(ctx)
 	}
+	sinks := r.openSinks(ctx, s.Code(), run)
+	dedup := models.NewDedup()
 
-	products, err := mt.GetProducts(r.ctx, cts)
-	if err != nil {
-		fmt.Printf("[Metro] error getting products: %v", err)
+	out := make(chan models.Product, size)
+	scrapeErr := make(chan error, 1)
+	go func() {
+		scrapeErr <- s.GetProducts(ctx, cts, out)
+		close(out)
+	}()
+
+	batch := make([]models.Product, 0, size)
+	var relisted []models.Product // products listed again in another category
+	flush := func() {
+		// Batches scraped before a timeout are still worth keeping.
+		if len(batch) > 0 {
+			if err := r.DB.UpsertProductBatch(context.WithoutCancel(ctx), batch, r.ScrapeRun.ID); err != nil {
+				logger.Error("failed to import products", "products", len(batch), "error", err)
+				run.AddError(fmt.Errorf("error importing products: %w", err))
+			} else {
+				logger.Debug("imported products", "products", len(batch))
+				run.Products += len(batch)
+			}
+			batch = batch[:0]
+		}
+		if len(relisted) > 0 {
+			if err := r.DB.LinkProductCategories(context.WithoutCancel(ctx), relisted); err != nil {
+				logger.Error("failed to link products to categories", "products", len(relisted), "error", err)
+				run.AddError(fmt.Errorf("error linking products to categories: %w", err))
+			}
+			relisted = relisted[:0]
+		}
 	}
-	filename, err := utils.WriteToCsv("metro", r.csvHeader, products)
-	if err != nil {
-		fmt.Printf("[Metro] error writing to csv: %v", err)
+	var tick <-chan time.Time
+	if stream {
+		ticker := time.NewTicker(streamFlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+loop:
+	for {
+		select {
+		case p, ok := <-out:
+			if !ok {
+				break loop
+			}
+			duplicate, newCategory := dedup.Add(p)
+			if duplicate {
+				if newCategory {
+					p = models.Relisting(p)
+					sinks = writeSinks(ctx, sinks, p, run)
+					if stream {
+						relisted = append(relisted, p)
+					}
+				}
+				continue
+			}
+			sinks = writeSinks(ctx, sinks, p, run)
+			if !stream {
+				run.Products++
+				continue
+			}
+			batch = append(batch, p)
+			if len(batch) == size {
+				flush()
+			}
+		case <-tick:
+			flush()
+		}
+	}
+	if stream {
+		flush()
+	}
+	r.closeSinks(ctx, sinks, run, !stream)
+	run.Duplicates = dedup.Duplicates()
+	if run.Duplicates > 0 {
+		logger.Info("merged duplicate products", "duplicates", run.Duplicates)
 	}
-	r.Files = append(r.Files, filename)
-}
 
-func (r *Runner) startVarusScraper() {
-	log.Println("Starting Varus scraper")
-	vs := scrapers.NewVarusScraper()
-	cts, err := vs.GetCategories(r.ctx)
-	if err != nil {
-		fmt.Printf("[Varus] error getting categories: %v", err)
+	if err := <-scrapeErr; err != nil {
+		logger.Error("error getting products", "error", err)
+		run.AddError(fmt.Errorf("error getting products: %w", err))
 	}
-	tErr := vs.GetProductsTotalValues(r.ctx, cts)
-	if tErr != nil {
-		fmt.Printf("[Varus] error getting products total values: %v", tErr)
+	if !stream {
+		return
 	}
-	products, err := vs.GetProducts(r.ctx, cts)
-	if err != nil {
-		fmt.Printf("[Varus] error getting products: %v", err)
+	// Category links can only be pruned once all of the store's products are
+	// in, and only when none of its pages failed to load.
+	switch {
+	case r.ScrapeRun.ID == 0 || run.ErrorCount() > 0:
+	case sinceErr != nil:
+		logger.Error("not pruning category links", "error", sinceErr)
+	default:
+		if err := r.DB.PruneCategoryLinks(context.WithoutCancel(ctx), r.ScrapeRun.ID, s.Code(), since); err != nil {
+			logger.Error("failed to prune category links", "error", err)
+		}
 	}
-	filename, err := utils.WriteToCsv("varus", r.csvHeader, products)
-	if err != nil {
-		fmt.Printf("[Varus] error writing to csv: %v", err)
+}
+
+// openSinks opens r.Outputs for the store with code. Outputs that fail to
+// open are recorded as errors of the run and left out. Nothing is opened in a
+// dry run.
+func (r *Runner) openSinks(ctx context.Context, code string, run *models.StoreRun) []sink.Sink {
+	if r.DryRun {
+		return nil
 	}
-	r.Files = append(r.Files, filename)
+	name := sink.FileName(code, r.ScrapeRun.ID, r.ScrapeRun.StartedAt)
+	var sinks []sink.Sink
+	for _, spec := range r.Outputs {
+		sk, err := spec.Open(r.OutputDir, name)
+		if err != nil {
+			logging.FromContext(ctx).Error("error opening output", "output", spec.String(), "error", err)
+			run.AddError(fmt.Errorf("error opening %s output: %w", spec, err))
+			continue
+		}
+		sinks = append(sinks, sk)
+	}
+	return sinks
 }
 
-func (r *Runner) startAtbScraper() {
-	log.Println("Starting Atb scraper")
-	atb := scrapers.NewAtbScraper()
-	cts, err := atb.GetCategories(r.ctx)
-	if err != nil {
-		fmt.Printf("[Atb] error getting categories: %v", err)
+// writeSinks writes p to sinks and returns those still usable: a sink that
+// fails is recorded as an error of the run, closed and written to no more.
+func writeSinks(ctx context.Context, sinks []sink.Sink, p models.Product, run *models.StoreRun) []sink.Sink {
+	return slices.DeleteFunc(sinks, func(sk sink.Sink) bool {
+		err := sk.Write(p)
+		if err == nil {
+			return false
+		}
+		logging.FromContext(ctx).Error("error writing products", "error", err)
+		run.AddError(fmt.Errorf("error writing products: %w", err))
+		_ = sk.Close()
+		return true
+	})
+}
+
+// closeSinks closes sinks and, with collect set, adds the first file written
+// completely to r.Files. The other files hold the same products, so one is
+// enough to import the store.
+func (r *Runner) closeSinks(ctx context.Context, sinks []sink.Sink, run *models.StoreRun, collect bool) {
+	for _, sk := range sinks {
+		if err := sk.Close(); err != nil {
+			logging.FromContext(ctx).Error("error writing products", "error", err)
+			run.AddError(fmt.Errorf("error writing products: %w", err))
+			continue
+		}
+		if f, ok := sk.(sink.File); ok && collect {
+			r.mu.Lock()
+			r.Files = append(r.Files, f.Path())
+			r.mu.Unlock()
+			collect = false
+		}
 	}
-	products, err := atb.GetProducts(r.ctx, cts)
-	if err != nil {
-		fmt.Printf("[Atb] error getting products: %v", err)
+}
+
+// finishStore closes the store's part of the run once its scraper returns.
+func (r *Runner) finishStore(ctx context.Context, run *models.StoreRun) {
+	run.Finish(run.Products)
+	metrics.ProductsScraped.WithLabelValues(run.StoreCode).Add(float64(run.Products))
+	metrics.ProductsDuplicated.WithLabelValues(run.StoreCode).Add(float64(run.Duplicates))
+	metrics.StoreRuns.WithLabelValues(run.StoreCode, string(run.Status)).Inc()
+	metrics.StoreRunDuration.WithLabelValues(run.StoreCode).Observe(run.FinishedAt.Sub(run.StartedAt).Seconds())
+	logging.FromContext(ctx).Info("scrape finished", "status", run.Status, "products", run.Products, "duplicates", run.Duplicates, "errors", run.ErrorCount())
+	r.saveStore(ctx, run)
+}
+
+// saveStore saves the outcome of the store's part of the run, even when the
+// scrape was cancelled.
+func (r *Runner) saveStore(ctx context.Context, run *models.StoreRun) {
+	if r.DB == nil || r.ScrapeRun.ID == 0 {
+		return
 	}
-	filename, err := utils.WriteToCsv("atb", r.csvHeader, products)
-	if err != nil {
-		fmt.Printf("[Atb] error writing to csv: %v", err)
+	if err := r.DB.FinishStoreRun(context.WithoutCancel(ctx), r.ScrapeRun, run); err != nil {
+		logging.FromContext(ctx).Error("failed to save scrape run", "error", err)
 	}
-	r.Files = append(r.Files, filename)
 }
 
 func (r *Runner) ConnectToDB(ctx context.Context) (*db.DB, error) {
@@ -119,27 +344,78 @@ func (r *Runner) ConnectToDB(ctx context.Context) (*db.DB, error) {
 	return database, nil
 }
 
-func (r *Runner) WriteCSVData(ctx context.Context, database *db.DB, files []string) error {
-	wg := sync.WaitGroup{}
+// Import imports the CSV or NDJSON files, told apart by their extension and
+// optionally gzip compressed, into the database. Every file is imported even
+// if some fail; the errors of all failed files are returned.
+//
+// Links to categories a product is no longer listed in are only dropped for
+// stores scraped in full by r's run; files of other runs, or of stores with
+// failed pages, only add links.
+func (r *Runner) Import(ctx context.Context, database *db.DB, files []string) error {
+	var runID int64
+	if r.ScrapeRun != nil {
+		runID = r.ScrapeRun.ID
+		ctx = logging.With(ctx, "run_id", runID)
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
 	for _, f := range files {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			products, err := database.ReadCSVData(f)
+		wg.Go(func() {
+			logger := logging.FromContext(ctx).With("file", f)
+			products, err := readProducts(database, f)
 			if err != nil {
-				log.Fatal("Failed to read CSV:", err)
+				logger.Error("failed to read products", "error", err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to read %s: %w", f, err))
+				mu.Unlock()
+				return
 			}
 
-			log.Printf("Read %d products from CSV", len(products))
+			logger.Info("read products", "products", len(products))
 
-			err = database.BulkUpsertProducts(ctx, products)
+			upsert := database.UpsertProductBatch
+			if len(products) > 0 && r.scrapedInFull(products[0].StoreCode) {
+				upsert = database.BulkUpsertProducts
+			}
+			err = upsert(ctx, products, runID)
 			if err != nil {
-				log.Fatal("Failed to bulk upsert products:", err)
+				logger.Error("failed to bulk upsert products", "error", err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to import %s: %w", f, err))
+				mu.Unlock()
+				return
 			}
 
-			log.Println("Successfully imported products and prices")
-		}()
+			logger.Info("imported products and prices")
+		})
 	}
 	wg.Wait()
-	return nil
+	return errors.Join(errs...)
+}
+
+// scrapedInFull reports whether r's run scraped the store with code without
+// errors.
+func (r *Runner) scrapedInFull(code string) bool {
+	if r.ScrapeRun == nil {
+		return false
+	}
+	run := r.ScrapeRun.Store(code)
+	return run != nil && run.Status != models.RunSkipped && run.ErrorCount() == 0
+}
+
+// readProducts reads a file written by a CSV or NDJSON sink, gzip compressed
+// or not.
+func readProducts(database *db.DB, filename string) ([]models.Product, error) {
+	ext := filepath.Ext(strings.TrimSuffix(filename, ".gz"))
+	switch ext {
+	case ".csv":
+		return database.ReadCSVData(filename)
+	case ".ndjson":
+		return database.ReadNDJSONData(filename)
+	default:
+		return nil, fmt.Errorf("unsupported file type %q", ext)
+	}
 }
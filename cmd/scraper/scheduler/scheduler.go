@@ -0,0 +1,206 @@
+// Package scheduler runs the scraper of every store on its own cron schedule
+// for as long as the process lives.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrPuls/groceries-price-aggregator-go/cmd/scraper/runner"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/db"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/logging"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/scrapers"
+	"github.com/robfig/cron/v3"
+)
+
+// MissedPolicy decides what happens to runs that were due while the store's
+// previous run was still going or the scheduler was not running.
+type MissedPolicy string
+
+const (
+	// MissedSkip drops missed runs and waits for the next scheduled time.
+	MissedSkip MissedPolicy = "skip"
+	// MissedRunOnce starts a single catch-up run right away, however many
+	// runs were missed.
+	MissedRunOnce MissedPolicy = "run-once"
+)
+
+// ParseMissedPolicy parses "skip" or "run-once".
+func ParseMissedPolicy(s string) (MissedPolicy, error) {
+	switch p := MissedPolicy(s); p {
+	case MissedSkip, MissedRunOnce:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid missed run policy %q: expected skip or run-once", s)
+	}
+}
+
+// Job is the schedule of one store.
+type Job struct {
+	Store    string
+	Spec     string
+	Schedule cron.Schedule
+}
+
+// ParseJobs parses a semicolon separated list of store=schedule entries,
+// where schedule is a standard five field cron expression or a descriptor
+// such as @hourly, e.g. "silpo=0 */6 * * *;metro=@daily". The store "*"
+// schedules every store without an entry of its own.
+func ParseJobs(s string) ([]Job, error) {
+	specs := make(map[string]string)
+	for _, entry := range strings.Split(s, ";") {
+		code, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		code, spec = strings.TrimSpace(code), strings.TrimSpace(spec)
+		if !ok || code == "" || spec == "" {
+			return nil, fmt.Errorf("invalid schedule %q: expected store=cron expression", entry)
+		}
+		if code != "*" && !slices.Contains(scrapers.Codes(), code) {
+			return nil, fmt.Errorf("invalid schedule %q: unknown store %q", entry, code)
+		}
+		specs[code] = spec
+	}
+
+	var jobs []Job
+	for _, code := range scrapers.Codes() {
+		spec, ok := specs[code]
+		if !ok {
+			spec, ok = specs["*"]
+		}
+		if !ok {
+			continue
+		}
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q of store %q: %w", spec, code, err)
+		}
+		jobs = append(jobs, Job{Store: code, Spec: spec, Schedule: schedule})
+	}
+	return jobs, nil
+}
+
+// Scheduler runs Jobs, never more than one run per store at a time. Every
+// run is delayed by a random duration up to Jitter so that stores sharing a
+// schedule do not all start at once, and is cancelled after Timeout.
+//
+// NewRunner returns the runner for a scheduled run with its output and
+// database settings; the scheduler picks the stores. When DB is set, it is
+// used to find runs missed while the scheduler was down.
+type Scheduler struct {
+	Jobs            []Job
+	Jitter          time.Duration
+	Missed          MissedPolicy
+	Timeout         time.Duration
+	ShutdownTimeout time.Duration
+	DB              *db.DB
+	NewRunner       func(ctx context.Context) *runner.Runner
+}
+
+// Run schedules the jobs until ctx is cancelled. Runs in progress at that
+// point are given ShutdownTimeout to finish before they are cancelled too.
+func (s *Scheduler) Run(ctx context.Context) {
+	runCtx, cancelRuns := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRuns()
+	go func() {
+		<-ctx.Done()
+		select {
+		case <-time.After(s.ShutdownTimeout):
+			slog.Warn("shutdown timeout reached, cancelling runs in progress")
+			cancelRuns()
+		case <-runCtx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, job := range s.Jobs {
+		slog.Info("scheduling store", "store", job.Store, "schedule", job.Spec, "next", job.Schedule.Next(time.Now()))
+		wg.Go(func() { s.loop(ctx, runCtx, job) })
+	}
+	wg.Wait()
+}
+
+// loop runs job at its scheduled times until ctx is cancelled. Runs happen in
+// this goroutine, so a slow run delays the next one instead of overlapping it.
+func (s *Scheduler) loop(ctx, runCtx context.Context, job Job) {
+	ctx = logging.With(ctx, "store", job.Store)
+	logger := logging.FromContext(ctx)
+
+	next := job.Schedule.Next(time.Now())
+	if s.missedWhileDown(ctx, job) {
+		if s.Missed == MissedRunOnce {
+			logger.Info("run missed while the scheduler was down, catching up")
+			next = time.Now()
+		} else {
+			logger.Info("run missed while the scheduler was down, skipping it")
+		}
+	}
+
+	for {
+		wait := time.Until(next)
+		if s.Jitter > 0 {
+			wait += rand.N(s.Jitter)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.run(runCtx, job)
+
+		now := time.Now()
+		if due := job.Schedule.Next(next); due.Before(now) {
+			if s.Missed == MissedRunOnce {
+				logger.Warn("run was due while the previous run was in progress, catching up", "due", due)
+				next = now
+				continue
+			}
+			logger.Warn("run was due while the previous run was in progress, skipping it", "due", due)
+		}
+		next = job.Schedule.Next(now)
+	}
+}
+
+// missedWhileDown reports whether a run of job was due since the store was
+// last scraped. Without a database nothing is known to be missed, and stores
+// never scraped before, as on a fresh database, wait for their schedule.
+func (s *Scheduler) missedWhileDown(ctx context.Context, job Job) bool {
+	if s.DB == nil {
+		return false
+	}
+	last, err := s.DB.LastStoreRun(ctx, job.Store)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to get last run", "error", err)
+		return false
+	}
+	return !last.IsZero() && job.Schedule.Next(last).Before(time.Now())
+}
+
+// run scrapes the store of job and imports the products.
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	logger := logging.FromContext(ctx).With("store", job.Store)
+
+	r := s.NewRunner(ctx)
+	r.Stores = []string{job.Store}
+	r.Run()
+	if r.DB == nil || r.DryRun || len(r.Files) == 0 {
+		return
+	}
+	if err := r.Import(ctx, r.DB, r.Files); err != nil {
+		logger.Error("failed to import products", "error", err)
+		return
+	}
+	logger.Info("products imported successfully")
+}
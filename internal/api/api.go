@@ -2,15 +2,18 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/MrPuls/groceries-price-aggregator-go/internal/db"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/logging"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type Store struct {
@@ -26,13 +29,55 @@ type ProductStoreMapping struct {
 
 type Product struct {
 	Name         string      `json:"name"`
+	Brand        string      `json:"brand,omitempty"`
+	EAN          string      `json:"ean,omitempty"`
+	ImageURL     string      `json:"image_url,omitempty"`
+	Description  string      `json:"description,omitempty"`
 	Stores       []string    `json:"available_stores"`
 	StoreMapping interface{} `json:"product_store_mapping"`
 }
 
+// Category is a node of a store's category tree. ParentID is nil for the
+// store's top level categories.
+type Category struct {
+	ID           int64  `json:"id"`
+	Store        string `json:"store"`
+	Ref          string `json:"ref"`
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	ParentID     *int64 `json:"parent_id"`
+	ProductCount int    `json:"product_count"`
+}
+
+// CategoryProduct is a product listed in a category or one of its
+// subcategories.
+type CategoryProduct struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Store    string `json:"store"`
+	Brand    string `json:"brand,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// ProductPrice is the latest price of a product. OnSale is only set while the
+// promotion is running. InStock and StockQty are left out for stores that do
+// not report availability. UnitPrice is the price per QuantityUnit (kg, l or
+// pcs), left out when the package size is unknown.
 type ProductPrice struct {
-	Price    string `json:"price"`
-	Currency string `json:"currency"`
+	Price        float64    `json:"price"`
+	RegularPrice float64    `json:"regular_price"`
+	PromoPrice   *float64   `json:"promo_price,omitempty"`
+	PromoEndsAt  *time.Time `json:"promo_ends_at,omitempty"`
+	OnSale       bool       `json:"on_sale"`
+	InStock      *bool      `json:"in_stock,omitempty"`
+	StockQty     *float64   `json:"stock_qty,omitempty"`
+	UnitPrice    *float64   `json:"unit_price,omitempty"`
+	Quantity     *float64   `json:"quantity,omitempty"`
+	QuantityUnit string     `json:"quantity_unit,omitempty"`
+	Currency     string     `json:"currency"`
+	Branch       string     `json:"branch,omitempty"`
+	Region       string     `json:"region,omitempty"`
+	ScrapedAt    time.Time  `json:"scraped_at"`
 }
 
 type Server struct {
@@ -49,21 +94,26 @@ func NewServer(port int, db *db.DB) *Server {
 	}
 }
 
-func (s *Server) Start() {
-	log.Printf("Starting server on port %d", s.Port)
+// Start serves the API until the listener fails.
+func (s *Server) Start() error {
+	slog.Info("starting server", "port", s.Port)
 
 	s.Router.HandleFunc("GET /", s.helloWorld)
+	s.Router.Handle("GET /metrics", promhttp.Handler())
 	s.Router.HandleFunc("GET /api/v1/stores", s.corsMiddleware(s.getStores))
 	s.Router.HandleFunc("OPTIONS /api/v1/stores", s.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {}))
+	s.Router.HandleFunc("GET /api/v1/brands", s.corsMiddleware(s.getBrands))
+	s.Router.HandleFunc("OPTIONS /api/v1/brands", s.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {}))
+	s.Router.HandleFunc("GET /api/v1/categories", s.corsMiddleware(s.getCategories))
+	s.Router.HandleFunc("OPTIONS /api/v1/categories", s.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {}))
+	s.Router.HandleFunc("GET /api/v1/categories/{categoryId}/products", s.corsMiddleware(s.getCategoryProducts))
+	s.Router.HandleFunc("OPTIONS /api/v1/categories/{categoryId}/products", s.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {}))
 	s.Router.HandleFunc("GET /api/v1/products", s.corsMiddleware(s.getProducts))
 	s.Router.HandleFunc("OPTIONS /api/v1/products", s.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {}))
 	s.Router.HandleFunc("GET /api/v1/products/{productId}", s.corsMiddleware(s.getProductById))
 	s.Router.HandleFunc("OPTIONS /api/v1/products/{productId}", s.corsMiddleware(func(w http.ResponseWriter, r *http.Request) {}))
 
-	err := http.ListenAndServe(fmt.Sprintf(":%v", s.Port), s.Router)
-	if err != nil {
-		log.Fatal(err)
-	}
+	return http.ListenAndServe(fmt.Sprintf(":%v", s.Port), requestIDMiddleware(metricsMiddleware(s.Router)))
 }
 
 func (s *Server) helloWorld(w http.ResponseWriter, r *http.Request) {
@@ -73,6 +123,21 @@ func (s *Server) helloWorld(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// requestIDMiddleware tags every request with an id, taken from the
+// X-Request-ID header when the client sends one, and puts a logger carrying
+// it in the request context.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" {
+			id = rand.Text()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := logging.With(r.Context(), "request_id", id, "method", r.Method, "path", r.URL.Path)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (s *Server) setCORSHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
@@ -100,7 +165,7 @@ func (s *Server) getStores(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := s.DB.Pool.Query(ctx, "SELECT id, name, code FROM stores")
 	if err != nil {
-		log.Printf("Database query failed: %v", err)
+		logging.FromContext(r.Context()).Error("database query failed", "error", err)
 		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -111,7 +176,7 @@ func (s *Server) getStores(w http.ResponseWriter, r *http.Request) {
 		var store Store
 		err := rows.Scan(&store.ID, &store.Name, &store.Code)
 		if err != nil {
-			log.Printf("Failed to scan row: %v", err)
+			logging.FromContext(r.Context()).Error("failed to scan row", "error", err)
 			http.Error(w, fmt.Sprintf("Failed to scan row: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -119,14 +184,164 @@ func (s *Server) getStores(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Row iteration error: %v", err)
+		logging.FromContext(r.Context()).Error("row iteration error", "error", err)
 		http.Error(w, fmt.Sprintf("Row iteration error: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	jsonData, err := json.Marshal(stores)
 	if err != nil {
-		log.Printf("JSON marshaling failed: %v", err)
+		logging.FromContext(r.Context()).Error("JSON marshaling failed", "error", err)
+		http.Error(w, fmt.Sprintf("JSON marshaling failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	_, wErr := w.Write(jsonData)
+	if wErr != nil {
+		return
+	}
+}
+
+func (s *Server) getBrands(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.Pool.Query(ctx, "SELECT DISTINCT brand FROM products WHERE brand IS NOT NULL ORDER BY brand")
+	if err != nil {
+		logging.FromContext(r.Context()).Error("database query failed", "error", err)
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	brands := []string{}
+	for rows.Next() {
+		var brand string
+		if err := rows.Scan(&brand); err != nil {
+			logging.FromContext(r.Context()).Error("failed to scan row", "error", err)
+			http.Error(w, fmt.Sprintf("Failed to scan row: %v", err), http.StatusInternalServerError)
+			return
+		}
+		brands = append(brands, brand)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(r.Context()).Error("row iteration error", "error", err)
+		http.Error(w, fmt.Sprintf("Row iteration error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(brands)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("JSON marshaling failed", "error", err)
+		http.Error(w, fmt.Sprintf("JSON marshaling failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	_, wErr := w.Write(jsonData)
+	if wErr != nil {
+		return
+	}
+}
+
+func (s *Server) getCategories(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// store narrows the categories down to a single store code
+	store := r.URL.Query().Get("store")
+	rows, err := s.DB.Pool.Query(ctx, `
+		SELECT c.id, st.code, c.ref, COALESCE(c.name, ''), COALESCE(c.path, ''), c.parent_id, count(pc.product_id)
+		FROM categories c
+			JOIN stores st ON st.id = c.store_id
+			LEFT JOIN product_categories pc ON pc.category_id = c.id
+		WHERE ($1 = '' OR st.code = $1)
+		GROUP BY c.id, st.code
+		ORDER BY st.code, c.path`, store)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("database query failed", "error", err)
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	categories := []Category{}
+	for rows.Next() {
+		var category Category
+		err := rows.Scan(&category.ID, &category.Store, &category.Ref, &category.Name, &category.Path, &category.ParentID, &category.ProductCount)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to scan row", "error", err)
+			http.Error(w, fmt.Sprintf("Failed to scan row: %v", err), http.StatusInternalServerError)
+			return
+		}
+		categories = append(categories, category)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(r.Context()).Error("row iteration error", "error", err)
+		http.Error(w, fmt.Sprintf("Row iteration error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(categories)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("JSON marshaling failed", "error", err)
+		http.Error(w, fmt.Sprintf("JSON marshaling failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	_, wErr := w.Write(jsonData)
+	if wErr != nil {
+		return
+	}
+}
+
+func (s *Server) getCategoryProducts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	categoryId := r.PathValue("categoryId")
+	rows, err := s.DB.Pool.Query(ctx, `
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE id = $1
+			UNION
+			SELECT c.id FROM categories c JOIN subtree ON c.parent_id = subtree.id
+		)
+		SELECT DISTINCT p.id, p.name, st.code, COALESCE(p.brand, ''), COALESCE(p.image_url, '')
+		FROM products p
+			JOIN product_categories pc ON pc.product_id = p.id
+			JOIN subtree ON subtree.id = pc.category_id
+			JOIN stores st ON st.id = p.store_id
+		ORDER BY p.name`, categoryId)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("database query failed", "error", err)
+		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	products := []CategoryProduct{}
+	for rows.Next() {
+		var product CategoryProduct
+		err := rows.Scan(&product.ID, &product.Name, &product.Store, &product.Brand, &product.ImageURL)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to scan row", "error", err)
+			http.Error(w, fmt.Sprintf("Failed to scan row: %v", err), http.StatusInternalServerError)
+			return
+		}
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		logging.FromContext(r.Context()).Error("row iteration error", "error", err)
+		http.Error(w, fmt.Sprintf("Row iteration error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(products)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("JSON marshaling failed", "error", err)
 		http.Error(w, fmt.Sprintf("JSON marshaling failed: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -142,9 +357,11 @@ func (s *Server) getProducts(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	query := strings.ReplaceAll(r.URL.Query().Get("q"), " ", " & ")
+	// brand narrows the search down to a single brand, as listed by /api/v1/brands
+	brand := r.URL.Query().Get("brand")
 	rows, err := s.DB.Pool.Query(
 		ctx, `
-		SELECT p1.name,
+		SELECT p1.name, COALESCE(p1.brand, ''), COALESCE(p1.ean, ''), COALESCE(p1.image_url, ''), COALESCE(p1.description, ''),
 	   	jsonb_object_agg(p_info.store_name, p_info.id) as product_store_mapping,
 	   	array_agg(DISTINCT p_info.store_name) as available_stores
 		FROM products p1
@@ -157,9 +374,10 @@ func (s *Server) getProducts(w http.ResponseWriter, r *http.Request) {
 		  AND to_tsvector('ukrainian', p1.name) @@ to_tsquery('ukrainian', $1)
 		  AND to_tsvector('ukrainian', p_info.name) @@ to_tsquery('ukrainian', $1)
 		  AND similarity(p1.name, p_info.name) > 0.9
-		GROUP BY p1.name, p1.id;`, query)
+		  AND ($2 = '' OR p1.brand ILIKE $2)
+		GROUP BY p1.name, p1.id;`, query, brand)
 	if err != nil {
-		log.Printf("Database query failed: %v", err)
+		logging.FromContext(r.Context()).Error("database query failed", "error", err)
 		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -167,23 +385,23 @@ func (s *Server) getProducts(w http.ResponseWriter, r *http.Request) {
 	var products []Product
 	for rows.Next() {
 		var product Product
-		err := rows.Scan(&product.Name, &product.StoreMapping, &product.Stores)
+		err := rows.Scan(&product.Name, &product.Brand, &product.EAN, &product.ImageURL, &product.Description, &product.StoreMapping, &product.Stores)
 		if err != nil {
-			log.Printf("Failed to scan row: %v", err)
+			logging.FromContext(r.Context()).Error("failed to scan row", "error", err)
 			http.Error(w, fmt.Sprintf("Failed to scan row: %v", err), http.StatusInternalServerError)
 		}
 		products = append(products, product)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Row iteration error: %v", err)
+		logging.FromContext(r.Context()).Error("row iteration error", "error", err)
 		http.Error(w, fmt.Sprintf("Row iteration error: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	jsonData, err := json.Marshal(products)
 	if err != nil {
-		log.Printf("JSON marshaling failed: %v", err)
+		logging.FromContext(r.Context()).Error("JSON marshaling failed", "error", err)
 		http.Error(w, fmt.Sprintf("JSON marshaling failed: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -199,31 +417,47 @@ func (s *Server) getProductById(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	productId := r.PathValue("productId")
-	rows, err := s.DB.Pool.Query(ctx, "SELECT price, currency FROM prices WHERE product_id = $1", productId)
+	// region narrows the price down to a city (or branch id) for stores that price per branch
+	region := r.URL.Query().Get("region")
+	rows, err := s.DB.Pool.Query(ctx, `
+		SELECT pr.price, COALESCE(pr.regular_price, pr.price), pr.promo_price, pr.promo_ends_at,
+		       pr.in_stock, pr.stock_qty, pr.unit_price, p.quantity, COALESCE(p.quantity_unit, ''),
+		       pr.currency, COALESCE(b.ref, ''), COALESCE(b.region, ''), pr.scraped_at
+		FROM prices pr
+			JOIN products p ON p.id = pr.product_id
+			LEFT JOIN branches b ON b.id = pr.branch_id
+		WHERE pr.product_id = $1
+		  AND ($2 = '' OR b.region ILIKE $2 OR b.ref = $2)
+		ORDER BY pr.scraped_at`, productId, region)
 	if err != nil {
-		log.Printf("Database query failed: %v", err)
+		logging.FromContext(r.Context()).Error("database query failed", "error", err)
 		http.Error(w, fmt.Sprintf("Database query failed: %v", err), http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 	var productPrice ProductPrice
 	for rows.Next() {
-		err := rows.Scan(&productPrice.Price, &productPrice.Currency)
+		productPrice = ProductPrice{}
+		err := rows.Scan(&productPrice.Price, &productPrice.RegularPrice, &productPrice.PromoPrice, &productPrice.PromoEndsAt,
+			&productPrice.InStock, &productPrice.StockQty,
+			&productPrice.UnitPrice, &productPrice.Quantity, &productPrice.QuantityUnit, &productPrice.Currency, &productPrice.Branch, &productPrice.Region, &productPrice.ScrapedAt)
 		if err != nil {
-			log.Printf("Failed to scan row: %v", err)
+			logging.FromContext(r.Context()).Error("failed to scan row", "error", err)
 			http.Error(w, fmt.Sprintf("Failed to scan row: %v", err), http.StatusInternalServerError)
 		}
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Row iteration error: %v", err)
+		logging.FromContext(r.Context()).Error("row iteration error", "error", err)
 		http.Error(w, fmt.Sprintf("Row iteration error: %v", err), http.StatusInternalServerError)
 		return
 	}
+	productPrice.OnSale = productPrice.PromoPrice != nil && *productPrice.PromoPrice < productPrice.RegularPrice &&
+		(productPrice.PromoEndsAt == nil || productPrice.PromoEndsAt.After(time.Now()))
 
 	jsonData, err := json.Marshal(productPrice)
 	if err != nil {
-		log.Printf("JSON marshaling failed: %v", err)
+		logging.FromContext(r.Context()).Error("JSON marshaling failed", "error", err)
 		http.Error(w, fmt.Sprintf("JSON marshaling failed: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -1,14 +1,19 @@
 package db
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/models"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -17,16 +22,6 @@ type DB struct {
 	Pool *pgxpool.Pool
 }
 
-type Product struct {
-	Name      string
-	Ref       string
-	Price     string
-	Category  string
-	Shop      string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-}
-
 func NewDB(ctx context.Context) (*DB, error) {
 	pool, err := connect(ctx)
 	if err != nil {
@@ -61,8 +56,10 @@ func connect(ctx context.Context) (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
-func (db *DB) ReadCSVData(filename string) ([]Product, error) {
-	file, err := os.Open(filename)
+// ReadCSVData reads products written by a CSV sink, with their relistings
+// merged in, see models.MergeListings.
+func (db *DB) ReadCSVData(filename string) ([]models.Product, error) {
+	file, err := openFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open CSV file: %w", err)
 	}
@@ -77,12 +74,11 @@ func (db *DB) ReadCSVData(filename string) ([]Product, error) {
 	}
 
 	// Validate header
-	expectedHeader := []string{"Name", "Ref", "Price", "Category", "Shop"}
-	if len(header) != len(expectedHeader) {
-		return nil, fmt.Errorf("invalid CSV header: expected %v, got %v", expectedHeader, header)
+	if !slices.Equal(header, models.CSVHeader) {
+		return nil, fmt.Errorf("invalid CSV header: expected %v, got %v", models.CSVHeader, header)
 	}
 
-	var products []Product
+	var products []models.Product
 	for {
 		record, err := reader.Read()
 		if err == io.EOF {
@@ -92,62 +88,190 @@ func (db *DB) ReadCSVData(filename string) ([]Product, error) {
 			return nil, fmt.Errorf("failed to read CSV record: %w", err)
 		}
 
-		// Parse price (remove currency and convert)
-		//priceStr = strings.ReplaceAll(priceStr, " грн/шт", "")
-		//priceStr = strings.ReplaceAll(priceStr, ",", ".")
-		//price, err := strconv.ParseFloat(priceStr, 64)
-		//if err != nil {
-		//	return nil, fmt.Errorf("failed to parse price '%s': %w", record[2], err)
-		//}
-		name := strings.TrimSpace(record[0])
-		name = strings.ReplaceAll(name, "\"", "")
-		name = strings.ReplaceAll(name, "«", "")
-		name = strings.ReplaceAll(name, "»", "")
-		name = strings.ReplaceAll(name, ", ", "")
-
-		product := Product{
-			Name:     name,
-			Ref:      strings.TrimSpace(record[1]),
-			Price:    strings.TrimSpace(record[2]),
-			Category: strings.TrimSpace(record[3]),
-			Shop:     strings.TrimSpace(record[4]),
+		product, err := models.ParseCSVRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV record: %w", err)
+		}
+		products = append(products, product)
+	}
+
+	return models.MergeListings(products), nil
+}
+
+// ReadNDJSONData reads products written by an NDJSON sink, with their
+// relistings merged in.
+func (db *DB) ReadNDJSONData(filename string) ([]models.Product, error) {
+	file, err := openFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open NDJSON file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var products []models.Product
+	decoder := json.NewDecoder(file)
+	for {
+		var product models.Product
+		err := decoder.Decode(&product)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse NDJSON record: %w", err)
 		}
 		products = append(products, product)
 	}
 
-	return products, nil
+	return models.MergeListings(products), nil
+}
+
+// openFile opens filename for reading, decompressing it when its name ends in
+// .gz.
+func openFile(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(filename, ".gz") {
+		return file, nil
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return gzipFile{gz, file}, nil
+}
+
+// gzipFile closes both the gzip reader and the file underneath.
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f gzipFile) Close() error {
+	return errors.Join(f.Reader.Close(), f.file.Close())
+}
+
+// cleanName strips the quotes stores put around brand names in product
+// names.
+func cleanName(name string) string {
+	name = strings.TrimSpace(name)
+	name = strings.ReplaceAll(name, "\"", "")
+	name = strings.ReplaceAll(name, "«", "")
+	name = strings.ReplaceAll(name, "»", "")
+	return name
 }
 
-func (db *DB) upsertProducts(ctx context.Context, tx pgx.Tx, products []Product, storeIDs map[string]int64) (map[string]int64, error) {
+func (db *DB) upsertProducts(ctx context.Context, tx pgx.Tx, products []models.Product, storeIDs, categoryIDs map[string]int64) (map[string]int64, error) {
 	productIDs := make(map[string]int64)
 
 	for _, p := range products {
-		storeID := storeIDs[p.Shop]
+		storeID := storeIDs[p.StoreCode]
+		var categoryID *int64
+		if id, ok := categoryIDs[fmt.Sprintf("%s:%s", p.StoreCode, p.Category().Ref)]; ok {
+			categoryID = &id
+		}
 
 		var productID int64
 		err := tx.QueryRow(ctx, `
-			INSERT INTO products (store_id, ref, name, url, created_at, updated_at) 
-			VALUES ($1, $2, $3, $4, now(), now())
+			INSERT INTO products (store_id, ref, name, url, unit, brand, sku, ean, image_url, description, quantity, quantity_unit, category_id, created_at, updated_at) 
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''), $11, NULLIF($12, ''), $13, now(), now())
 			ON CONFLICT (store_id, ref) 
 			DO UPDATE SET 
 				name = EXCLUDED.name,
 				url = EXCLUDED.url,
+				unit = EXCLUDED.unit,
+				brand = COALESCE(EXCLUDED.brand, products.brand),
+				sku = COALESCE(EXCLUDED.sku, products.sku),
+				ean = COALESCE(EXCLUDED.ean, products.ean),
+				image_url = COALESCE(EXCLUDED.image_url, products.image_url),
+				description = COALESCE(EXCLUDED.description, products.description),
+				quantity = COALESCE(EXCLUDED.quantity, products.quantity),
+				quantity_unit = COALESCE(EXCLUDED.quantity_unit, products.quantity_unit),
+				category_id = COALESCE(EXCLUDED.category_id, products.category_id),
 				updated_at = now()
 			RETURNING id`,
-			storeID, p.Ref, p.Name, p.Ref).Scan(&productID)
+			storeID, p.ExternalID, cleanName(p.Name), p.URL, p.Unit, p.Brand, p.SKU, p.EAN, p.ImageURL, p.Description,
+			nullIfZero(p.Quantity), p.QuantityUnit, categoryID).Scan(&productID)
 
 		if err != nil {
 			return nil, fmt.Errorf("failed to upsert product '%s': %w", p.Name, err)
 		}
 
-		productIDs[fmt.Sprintf("%s:%s", p.Shop, p.Ref)] = productID
+		productIDs[fmt.Sprintf("%s:%s", p.StoreCode, p.ExternalID)] = productID
 	}
 
 	return productIDs, nil
 }
 
-// BulkUpsertProducts efficiently inserts/updates products and their prices
-func (db *DB) BulkUpsertProducts(ctx context.Context, products []Product) error {
+// BulkUpsertProducts efficiently inserts/updates products and their prices.
+// The prices reference the scrape run runID, or no run when it is zero. Links
+// to categories a product is not listed in are dropped, so products must come
+// from a store scraped in full; use UpsertProductBatch otherwise.
+func (db *DB) BulkUpsertProducts(ctx context.Context, products []models.Product, runID int64) error {
+	return db.bulkUpsertProducts(ctx, products, runID, true)
+}
+
+// UpsertProductBatch is BulkUpsertProducts for one of many batches of a
+// streamed import. A product can show up in several batches, so links to
+// categories it is no longer listed in are kept; PruneCategoryLinks drops
+// them once the import is done.
+func (db *DB) UpsertProductBatch(ctx context.Context, products []models.Product, runID int64) error {
+	return db.bulkUpsertProducts(ctx, products, runID, false)
+}
+
+// PruneCategoryLinks drops the category links of the store's products priced
+// in the scrape run runID that were not refreshed since the run started,
+// i.e. links to categories the products were not found in.
+func (db *DB) PruneCategoryLinks(ctx context.Context, runID int64, storeCode string, since time.Time) error {
+	_, err := db.Pool.Exec(ctx, `
+		DELETE FROM product_categories pc
+		USING products p, stores s
+		WHERE pc.product_id = p.id 
+			AND p.store_id = s.id 
+			AND s.code = $2
+			AND pc.updated_at < $3
+			AND p.id IN (SELECT product_id FROM prices WHERE run_id = $1)`,
+		runID, storeCode, since)
+	if err != nil {
+		return fmt.Errorf("failed to prune category links of store '%s': %w", storeCode, err)
+	}
+	return nil
+}
+
+// LinkProductCategories links products imported before to every category on
+// their category paths, upserting the categories, without touching their
+// prices or other links. Products not imported yet are left out.
+func (db *DB) LinkProductCategories(ctx context.Context, products []models.Product) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	storeIDs, err := db.getStoreIDs(ctx, tx, products)
+	if err != nil {
+		return fmt.Errorf("failed to get store IDs: %w", err)
+	}
+
+	categoryIDs, err := db.upsertCategories(ctx, tx, products, storeIDs)
+	if err != nil {
+		return fmt.Errorf("failed to upsert categories: %w", err)
+	}
+
+	productIDs, err := db.getProductIDs(ctx, tx, products, storeIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get product IDs: %w", err)
+	}
+
+	if err := db.linkProductCategories(ctx, tx, products, productIDs, categoryIDs, false); err != nil {
+		return fmt.Errorf("failed to link product categories: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (db *DB) bulkUpsertProducts(ctx context.Context, products []models.Product, runID int64, prune bool) error {
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -161,19 +285,35 @@ func (db *DB) BulkUpsertProducts(ctx context.Context, products []Product) error
 	}
 
 	// Upsert categories
-	_, err = db.upsertCategories(ctx, tx, products, storeIDs)
+	categoryIDs, err := db.upsertCategories(ctx, tx, products, storeIDs)
 	if err != nil {
 		return fmt.Errorf("failed to upsert categories: %w", err)
 	}
 
+	// Re-key products imported before they were keyed by store id
+	if err := db.rekeyProducts(ctx, tx, products, storeIDs); err != nil {
+		return fmt.Errorf("failed to re-key products: %w", err)
+	}
+
 	// Upsert products
-	productIDs, err := db.upsertProducts(ctx, tx, products, storeIDs)
+	productIDs, err := db.upsertProducts(ctx, tx, products, storeIDs, categoryIDs)
 	if err != nil {
 		return fmt.Errorf("failed to upsert products: %w", err)
 	}
 
+	// Link products to categories
+	if err := db.linkProductCategories(ctx, tx, products, productIDs, categoryIDs, prune); err != nil {
+		return fmt.Errorf("failed to link product categories: %w", err)
+	}
+
+	// Upsert branches
+	branchIDs, err := db.upsertBranches(ctx, tx, products, storeIDs)
+	if err != nil {
+		return fmt.Errorf("failed to upsert branches: %w", err)
+	}
+
 	// Insert prices
-	if err := db.insertPrices(ctx, tx, products, productIDs); err != nil {
+	if err := db.insertPrices(ctx, tx, products, productIDs, branchIDs, runID); err != nil {
 		return fmt.Errorf("failed to insert prices: %w", err)
 	}
 
@@ -181,17 +321,20 @@ func (db *DB) BulkUpsertProducts(ctx context.Context, products []Product) error
 }
 
 // getStoreIDs retrieves store IDs for all shops in the products
-func (db *DB) getStoreIDs(ctx context.Context, tx pgx.Tx, products []Product) (map[string]int64, error) {
+func (db *DB) getStoreIDs(ctx context.Context, tx pgx.Tx, products []models.Product) (map[string]int64, error) {
 	// Get unique shop names
 	shops := make(map[string]bool)
 	for _, p := range products {
-		shops[p.Shop] = true
+		shops[p.StoreCode] = true
 	}
 
 	storeIDs := make(map[string]int64)
 	for shop := range shops {
 		var storeID int64
 		err := tx.QueryRow(ctx, "SELECT id FROM stores WHERE name = $1 OR code = $1", shop).Scan(&storeID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, unknownStore(shop)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("store '%s' not found: %w", shop, err)
 		}
@@ -201,57 +344,249 @@ func (db *DB) getStoreIDs(ctx context.Context, tx pgx.Tx, products []Product) (m
 	return storeIDs, nil
 }
 
-// upsertCategories inserts or updates categories
-func (db *DB) upsertCategories(ctx context.Context, tx pgx.Tx, products []Product, storeIDs map[string]int64) (map[string]int64, error) {
-	// Get unique categories per store
-	categories := make(map[string]map[string]bool) // store -> category -> exists
+// unknownStore is the error for a store code without a row in stores, as
+// happens when a scraper is registered without a migration adding its store.
+func unknownStore(code string) error {
+	return fmt.Errorf("store '%s' not found: add it to the stores table in a migration", code)
+}
+
+// rekeyProducts moves products still keyed by their URL, as all products were
+// before they were keyed by the store's own id, over to their id so that they
+// keep their price history. Products already known by their id are left
+// alone.
+func (db *DB) rekeyProducts(ctx context.Context, tx pgx.Tx, products []models.Product, storeIDs map[string]int64) error {
+	refs := make(map[string][]string) // store -> product refs
+	urls := make(map[string][]string) // store -> product URLs
 	for _, p := range products {
-		if categories[p.Shop] == nil {
-			categories[p.Shop] = make(map[string]bool)
+		if p.URL == "" {
+			continue
 		}
-		categories[p.Shop][p.Category] = true
+		refs[p.StoreCode] = append(refs[p.StoreCode], p.ExternalID)
+		urls[p.StoreCode] = append(urls[p.StoreCode], p.URL)
 	}
 
-	categoryIDs := make(map[string]int64) // "store:category" -> id
+	for store := range refs {
+		_, err := tx.Exec(ctx, `
+			UPDATE products p SET ref = v.ref, updated_at = now()
+			FROM unnest($2::text[], $3::text[]) AS v(ref, url)
+			WHERE p.store_id = $1 
+				AND p.ref = v.url
+				AND NOT EXISTS (SELECT 1 FROM products q WHERE q.store_id = $1 AND q.ref = v.ref)`,
+			storeIDs[store], refs[store], urls[store])
+		if err != nil {
+			return fmt.Errorf("failed to re-key products of store '%s': %w", store, err)
+		}
+	}
 
-	for shop, cats := range categories {
-		storeID := storeIDs[shop]
-		for category := range cats {
-			slug := strings.ToLower(strings.ReplaceAll(category, " ", "-"))
+	return nil
+}
 
-			var categoryID int64
-			err := tx.QueryRow(ctx, `
-				INSERT INTO categories (store_id, slug, name, created_at, updated_at) 
-				VALUES ($1, $2, $3, now(), now())
-				ON CONFLICT (store_id, slug) 
-				DO UPDATE SET 
-					name = EXCLUDED.name, 
-					updated_at = now()
-				RETURNING id`,
-				storeID, slug, category).Scan(&categoryID)
+// getProductIDs looks up the IDs of the products already in the database.
+func (db *DB) getProductIDs(ctx context.Context, tx pgx.Tx, products []models.Product, storeIDs map[string]int64) (map[string]int64, error) {
+	refs := make(map[string][]string) // store -> product refs
+	for _, p := range products {
+		refs[p.StoreCode] = append(refs[p.StoreCode], p.ExternalID)
+	}
 
-			if err != nil {
-				return nil, fmt.Errorf("failed to upsert category '%s' for store '%s': %w", category, shop, err)
+	productIDs := make(map[string]int64)
+	for store, storeRefs := range refs {
+		rows, err := tx.Query(ctx, "SELECT id, ref FROM products WHERE store_id = $1 AND ref = ANY($2)", storeIDs[store], storeRefs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query products of store '%s': %w", store, err)
+		}
+		for rows.Next() {
+			var id int64
+			var ref string
+			if err := rows.Scan(&id, &ref); err != nil {
+				rows.Close()
+				return nil, err
 			}
+			productIDs[fmt.Sprintf("%s:%s", store, ref)] = id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return productIDs, nil
+}
+
+// upsertCategories inserts or updates every category on the products' category
+// paths, linking each to its parent. Paths run from the root down, so parents
+// are always upserted before their children.
+func (db *DB) upsertCategories(ctx context.Context, tx pgx.Tx, products []models.Product, storeIDs map[string]int64) (map[string]int64, error) {
+	categoryIDs := make(map[string]int64) // "store:ref" -> id
 
-			categoryIDs[fmt.Sprintf("%s:%s", shop, category)] = categoryID
+	for _, p := range products {
+		for _, categoryPath := range p.CategoryPaths() {
+			if err := db.upsertCategoryPath(ctx, tx, p.StoreCode, storeIDs[p.StoreCode], categoryPath, categoryIDs); err != nil {
+				return nil, err
+			}
 		}
 	}
 
 	return categoryIDs, nil
 }
 
+// upsertCategoryPath upserts the categories on categoryPath not in categoryIDs
+// yet and adds them.
+func (db *DB) upsertCategoryPath(ctx context.Context, tx pgx.Tx, storeCode string, storeID int64, categoryPath []models.CategoryRef, categoryIDs map[string]int64) error {
+	var parentID *int64
+	for i, c := range categoryPath {
+		key := fmt.Sprintf("%s:%s", storeCode, c.Ref)
+		if id, ok := categoryIDs[key]; ok {
+			parentID = &id
+			continue
+		}
+		path := make([]string, 0, i+1)
+		for _, ancestor := range categoryPath[:i+1] {
+			path = append(path, ancestor.Name)
+		}
+
+		var categoryID int64
+		err := tx.QueryRow(ctx, `
+			INSERT INTO categories (store_id, ref, slug, name, parent_id, path, created_at, updated_at) 
+			VALUES ($1, $2, $2, $3, $4, $5, now(), now())
+			ON CONFLICT (store_id, ref) 
+			DO UPDATE SET 
+				name = EXCLUDED.name, 
+				parent_id = EXCLUDED.parent_id,
+				path = EXCLUDED.path,
+				updated_at = now()
+			RETURNING id`,
+			storeID, c.Ref, c.Name, parentID, strings.Join(path, " > ")).Scan(&categoryID)
+
+		if err != nil {
+			return fmt.Errorf("failed to upsert category '%s' for store '%s': %w", c.Name, storeCode, err)
+		}
+
+		categoryIDs[key] = categoryID
+		parentID = &categoryID
+	}
+
+	return nil
+}
+
+// linkProductCategories records every category each product was found in,
+// dropping the links to categories the product is no longer listed in when
+// prune is set.
+func (db *DB) linkProductCategories(ctx context.Context, tx pgx.Tx, products []models.Product, productIDs, categoryIDs map[string]int64, prune bool) error {
+	links := make(map[int64][]int64) // product id -> category ids
+	for _, p := range products {
+		productID, ok := productIDs[fmt.Sprintf("%s:%s", p.StoreCode, p.ExternalID)]
+		if !ok {
+			continue
+		}
+		for _, path := range p.CategoryPaths() {
+			categoryID, ok := categoryIDs[fmt.Sprintf("%s:%s", p.StoreCode, path[len(path)-1].Ref)]
+			if !ok || slices.Contains(links[productID], categoryID) {
+				continue
+			}
+			links[productID] = append(links[productID], categoryID)
+		}
+	}
+
+	batch := &pgx.Batch{}
+	for productID, ids := range links {
+		if prune {
+			batch.Queue(`
+				DELETE FROM product_categories 
+				WHERE product_id = $1 AND NOT (category_id = ANY($2))`,
+				productID, ids)
+		}
+		batch.Queue(`
+			INSERT INTO product_categories (product_id, category_id, created_at, updated_at) 
+			SELECT $1, unnest($2::bigint[]), now(), now()
+			ON CONFLICT (product_id, category_id) 
+			DO UPDATE SET updated_at = now()`,
+			productID, ids)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	defer func() { _ = results.Close() }()
+
+	for i := 0; i < batch.Len(); i++ {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("failed to link categories of product: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// upsertBranches inserts or updates the branches prices were scraped from
+func (db *DB) upsertBranches(ctx context.Context, tx pgx.Tx, products []models.Product, storeIDs map[string]int64) (map[string]int64, error) {
+	branchIDs := make(map[string]int64) // "store:branch" -> id
+
+	for _, p := range products {
+		key := fmt.Sprintf("%s:%s", p.StoreCode, p.Branch)
+		if p.Branch == "" {
+			continue
+		}
+		if _, ok := branchIDs[key]; ok {
+			continue
+		}
+
+		var branchID int64
+		err := tx.QueryRow(ctx, `
+			INSERT INTO branches (store_id, ref, name, region, created_at, updated_at) 
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), now(), now())
+			ON CONFLICT (store_id, ref) 
+			DO UPDATE SET 
+				name = COALESCE(EXCLUDED.name, branches.name),
+				region = COALESCE(EXCLUDED.region, branches.region),
+				updated_at = now()
+			RETURNING id`,
+			storeIDs[p.StoreCode], p.Branch, p.BranchName, p.Region).Scan(&branchID)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to upsert branch '%s' for store '%s': %w", p.Branch, p.StoreCode, err)
+		}
+
+		branchIDs[key] = branchID
+	}
+
+	return branchIDs, nil
+}
+
+// nullIfZero maps the zero value models.Product uses for unknown numbers to
+// NULL.
+func nullIfZero(f float64) *float64 {
+	if f == 0 {
+		return nil
+	}
+	return &f
+}
+
 // insertPrices inserts new price records
-func (db *DB) insertPrices(ctx context.Context, tx pgx.Tx, products []Product, productIDs map[string]int64) error {
+func (db *DB) insertPrices(ctx context.Context, tx pgx.Tx, products []models.Product, productIDs, branchIDs map[string]int64, runID int64) error {
+	var run *int64
+	if runID != 0 {
+		run = &runID
+	}
+
 	// Prepare batch insert
 	batch := &pgx.Batch{}
 
 	for _, p := range products {
-		productID := productIDs[fmt.Sprintf("%s:%s", p.Shop, p.Ref)]
+		productID := productIDs[fmt.Sprintf("%s:%s", p.StoreCode, p.ExternalID)]
+		var branchID *int64
+		if id, ok := branchIDs[fmt.Sprintf("%s:%s", p.StoreCode, p.Branch)]; ok {
+			branchID = &id
+		}
+		regularPrice := &p.RegularPrice
+		if p.RegularPrice == 0 {
+			regularPrice = &p.Price
+		}
+		var promoEndsAt *time.Time
+		if !p.PromoEndsAt.IsZero() {
+			promoEndsAt = &p.PromoEndsAt
+		}
 		batch.Queue(`
-			INSERT INTO prices (product_id, price, currency, created_at, updated_at) 
-			VALUES ($1, $2, $3, now(), now())`,
-			productID, p.Price, "UAH")
+			INSERT INTO prices (product_id, branch_id, price, regular_price, promo_price, promo_ends_at, in_stock, stock_qty, unit_price, currency, scraped_at, run_id, created_at, updated_at) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now(), now())`,
+			productID, branchID, p.Price, regularPrice, nullIfZero(p.PromoPrice), promoEndsAt, p.InStock, p.StockQty, nullIfZero(p.UnitPrice), p.Currency, p.ScrapedAt, run)
 	}
 
 	results := tx.SendBatch(ctx, batch)
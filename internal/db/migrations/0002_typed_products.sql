@@ -0,0 +1,27 @@
+-- Numeric prices instead of free-form "12.50 грн" text
+alter table prices
+    alter column price type numeric(12, 2)
+        using nullif(regexp_replace(replace(price, ',', '.'), '[^0-9.]', '', 'g'), '')::numeric;
+
+alter table prices
+    add column if not exists scraped_at timestamptz not null default now();
+
+-- Sale unit as reported by the store (e.g. "кг", "шт")
+alter table products
+    add column if not exists unit text;
+
+-- Products were keyed by their URL and are keyed by the store's own product
+-- id now. ATB's id is the last segment of the product URL. The ids of the
+-- other stores are not part of their URLs; their products are re-keyed when
+-- they are next imported, matched by the URL still held in ref.
+update products p
+set ref = regexp_replace(rtrim(p.ref, '/'), '^.*/', '')
+from stores s
+where p.store_id = s.id
+  and s.code = 'atb'
+  and p.ref like 'http%'
+  and not exists (
+    select 1 from products q
+    where q.store_id = p.store_id
+      and q.ref = regexp_replace(rtrim(p.ref, '/'), '^.*/', '')
+);
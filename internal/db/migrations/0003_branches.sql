@@ -0,0 +1,16 @@
+-- Branches (shops or delivery areas) of stores that price per branch
+create table if not exists branches (
+                                        id bigserial primary key,
+                                        store_id bigint not null references stores(id) on delete cascade,
+                                        ref text not null,
+                                        region text,
+                                        created_at timestamptz not null default now(),
+                                        updated_at timestamptz not null default now(),
+                                        unique (store_id, ref)
+);
+
+-- Null for stores with a single national price
+alter table prices
+    add column if not exists branch_id bigint references branches(id) on delete set null;
+
+create index if not exists prices_product_branch_idx on prices (product_id, branch_id);
@@ -0,0 +1,9 @@
+-- Chains scraped through zakaz.ua besides Metro
+insert into stores(code, name) values
+                                   ('novus', 'Novus'),
+                                   ('auchan', 'Auchan'),
+                                   ('eko', 'Eko Market'),
+                                   ('megamarket', 'Megamarket'),
+                                   ('ultramarket', 'Ultramarket'),
+                                   ('tavriav', 'Tavria V')
+on conflict (code) do nothing;
@@ -0,0 +1,9 @@
+-- Regular and promotional prices; prices.price stays the price charged when scraped
+alter table prices
+    add column if not exists regular_price numeric(12, 2),
+    add column if not exists promo_price numeric(12, 2),
+    add column if not exists promo_ends_at timestamptz;
+
+update prices set regular_price = price where regular_price is null;
+
+create index if not exists prices_on_sale_idx on prices (product_id, scraped_at) where promo_price is not null;
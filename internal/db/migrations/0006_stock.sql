@@ -0,0 +1,4 @@
+-- Availability at the time of scraping; null when the store does not report it
+alter table prices
+    add column if not exists in_stock boolean,
+    add column if not exists stock_qty numeric(12, 3);
@@ -0,0 +1,10 @@
+-- Product details shown by the frontend; null when the store does not list them
+alter table products
+    add column if not exists brand text,
+    add column if not exists sku text,
+    add column if not exists ean text,
+    add column if not exists image_url text,
+    add column if not exists description text;
+
+create index if not exists products_brand_idx on products (brand);
+create index if not exists products_ean_idx on products (ean) where ean is not null;
@@ -0,0 +1,9 @@
+-- Package size normalised to kg, l or pcs, and the price per that unit
+alter table products
+    add column if not exists quantity numeric(12, 3),
+    add column if not exists quantity_unit text;
+
+alter table prices
+    add column if not exists unit_price numeric(12, 2);
+
+create index if not exists products_quantity_unit_idx on products (quantity_unit);
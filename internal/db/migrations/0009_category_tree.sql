@@ -0,0 +1,18 @@
+-- Category tree: the store's own category id, the parent link and the path of
+-- names from the root. slug keeps the id as well for older readers.
+alter table categories
+    add column if not exists ref text,
+    add column if not exists parent_id bigint references categories(id) on delete set null,
+    add column if not exists path text;
+
+update categories set ref = slug where ref is null;
+
+alter table categories
+    alter column ref set not null;
+
+create unique index if not exists categories_store_ref_idx on categories (store_id, ref);
+create index if not exists categories_parent_idx on categories (parent_id);
+
+-- Leaf category the product was last found in
+alter table products
+    add column if not exists category_id bigint references categories(id) on delete set null;
@@ -0,0 +1,15 @@
+-- Every category a product is listed in; products.category_id stays the leaf
+-- category it was last found in
+create table if not exists product_categories (
+                                                  product_id bigint not null references products(id) on delete cascade,
+                                                  category_id bigint not null references categories(id) on delete cascade,
+                                                  created_at timestamptz not null default now(),
+                                                  updated_at timestamptz not null default now(),
+                                                  primary key (product_id, category_id)
+);
+
+create index if not exists product_categories_category_idx on product_categories (category_id);
+
+insert into product_categories (product_id, category_id)
+select id, category_id from products where category_id is not null
+on conflict do nothing;
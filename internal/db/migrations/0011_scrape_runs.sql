@@ -0,0 +1,28 @@
+-- Scrape runs and the per-store outcome of each
+create table if not exists scrape_runs (
+                                           id bigserial primary key,
+                                           status text not null default 'running',
+                                           started_at timestamptz not null default now(),
+                                           finished_at timestamptz,
+                                           product_count integer not null default 0,
+                                           error_count integer not null default 0
+);
+
+create table if not exists scrape_run_stores (
+                                                 id bigserial primary key,
+                                                 run_id bigint not null references scrape_runs(id) on delete cascade,
+                                                 store_id bigint not null references stores(id) on delete cascade,
+                                                 status text not null default 'running',
+                                                 started_at timestamptz,
+                                                 finished_at timestamptz,
+                                                 product_count integer not null default 0,
+                                                 error_count integer not null default 0,
+                                                 error_samples text[] not null default '{}',
+                                                 unique (run_id, store_id)
+);
+
+-- Run that scraped the price; null for prices imported outside a run
+alter table prices
+    add column if not exists run_id bigint references scrape_runs(id) on delete set null;
+
+create index if not exists prices_run_idx on prices (run_id);
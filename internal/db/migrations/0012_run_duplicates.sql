@@ -0,0 +1,6 @@
+-- Products listed more than once in a run, merged into one price each
+alter table scrape_runs
+    add column if not exists duplicate_count integer not null default 0;
+
+alter table scrape_run_stores
+    add column if not exists duplicate_count integer not null default 0;
@@ -0,0 +1,3 @@
+-- The store's own name for the branch, e.g. its street address
+alter table branches
+    add column if not exists name text;
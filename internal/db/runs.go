@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/models"
+)
+
+// StartRun saves a new scrape run, with a row per store, and sets run.ID. It
+// fails when a store of the run has no row in stores.
+func (db *DB) StartRun(ctx context.Context, run *models.ScrapeRun) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO scrape_runs (status, started_at) 
+		VALUES ($1, $2)
+		RETURNING id`,
+		run.Status, run.StartedAt).Scan(&run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert scrape run: %w", err)
+	}
+
+	for _, s := range run.Stores {
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO scrape_run_stores (run_id, store_id, status) 
+			SELECT $1, id, $3 FROM stores WHERE code = $2`,
+			run.ID, s.StoreCode, s.Status)
+		if err != nil {
+			return fmt.Errorf("failed to insert scrape run of store '%s': %w", s.StoreCode, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return unknownStore(s.StoreCode)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// FinishStoreRun saves the outcome of one store of a run.
+func (db *DB) FinishStoreRun(ctx context.Context, run *models.ScrapeRun, s *models.StoreRun) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE scrape_run_stores SET 
+			status = $3,
+			started_at = $4,
+			finished_at = $5,
+			product_count = $6,
+			error_count = $7,
+			error_samples = $8,
+			duplicate_count = $9
+		WHERE run_id = $1 AND store_id = (SELECT id FROM stores WHERE code = $2)`,
+		run.ID, s.StoreCode, s.Status, s.StartedAt, s.FinishedAt, s.Products, s.ErrorCount(), s.ErrorSamples(), s.Duplicates)
+	if err != nil {
+		return fmt.Errorf("failed to update scrape run of store '%s': %w", s.StoreCode, err)
+	}
+	return nil
+}
+
+// FinishRun saves the outcome of a run.
+func (db *DB) FinishRun(ctx context.Context, run *models.ScrapeRun) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE scrape_runs SET 
+			status = $2,
+			finished_at = $3,
+			product_count = $4,
+			error_count = $5,
+			duplicate_count = $6
+		WHERE id = $1`,
+		run.ID, run.Status, run.FinishedAt, run.Products(), run.Errors(), run.Duplicates())
+	if err != nil {
+		return fmt.Errorf("failed to update scrape run %d: %w", run.ID, err)
+	}
+	return nil
+}
+
+// TryLockStore takes a Postgres advisory lock on scraping the store with
+// code, so that runs in other processes skip the store instead of scraping
+// it twice. ok is false when another session holds the lock. The lock lives
+// on its own connection until unlock is called.
+func (db *DB) TryLockStore(ctx context.Context, code string) (unlock func(), ok bool, err error) {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	key := "scraper:" + code
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", key).Scan(&ok); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("failed to lock store '%s': %w", code, err)
+	}
+	if !ok {
+		conn.Release()
+		return nil, false, nil
+	}
+	return func() {
+		_, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", key)
+		conn.Release()
+	}, true, nil
+}
+
+// LastStoreRun returns when the store with code was last scraped, zero if it
+// never was.
+func (db *DB) LastStoreRun(ctx context.Context, code string) (time.Time, error) {
+	var last *time.Time
+	err := db.Pool.QueryRow(ctx, `
+		SELECT max(rs.started_at) 
+		FROM scrape_run_stores rs
+		JOIN stores s ON s.id = rs.store_id
+		WHERE s.code = $1 AND rs.status <> 'skipped'`,
+		code).Scan(&last)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last run of store '%s': %w", code, err)
+	}
+	if last == nil {
+		return time.Time{}, nil
+	}
+	return *last, nil
+}
+
+// Now returns the database clock, to compare with timestamps set by now() in
+// SQL without being thrown off by clock skew.
+func (db *DB) Now(ctx context.Context) (time.Time, error) {
+	var now time.Time
+	if err := db.Pool.QueryRow(ctx, "SELECT now()").Scan(&now); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get database time: %w", err)
+	}
+	return now, nil
+}
@@ -0,0 +1,122 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/logging"
+)
+
+// Concurrency configures the AIMD limiter of a Client. The limit starts at
+// Initial, grows by one per round of fast successful responses and is cut
+// sharply on 429/5xx, transport errors or when latency rises above
+// LatencyFactor times the observed baseline. Max == 0 disables the limiter.
+type Concurrency struct {
+	Min           int
+	Max           int
+	Initial       int
+	LatencyFactor float64
+}
+
+const (
+	aimdBackoffRatio        = 0.5
+	aimdLatencyBackoffRatio = 0.75
+	aimdCooldown            = time.Second
+	aimdBaselineWeight      = 0.05
+)
+
+type aimdLimiter struct {
+	cfg Concurrency
+	now func() time.Time
+
+	mu           sync.Mutex
+	limit        float64
+	inFlight     int
+	baseline     time.Duration
+	lastDecrease time.Time
+	changed      chan struct{}
+}
+
+func newAIMDLimiter(cfg Concurrency) *aimdLimiter {
+	if cfg.Max <= 0 {
+		return nil
+	}
+	cfg.Min = min(max(cfg.Min, 1), cfg.Max)
+	if cfg.Initial < cfg.Min || cfg.Initial > cfg.Max {
+		cfg.Initial = cfg.Min
+	}
+	if cfg.LatencyFactor <= 1 {
+		cfg.LatencyFactor = 2
+	}
+	return &aimdLimiter{
+		cfg:     cfg,
+		now:     time.Now,
+		limit:   float64(cfg.Initial),
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire blocks until a slot under the current limit is free.
+func (l *aimdLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// release frees the slot taken by acquire and adjusts the limit based on
+// the outcome of the request.
+func (l *aimdLimiter) release(req *http.Request, resp *http.Response, err error, latency time.Duration) {
+	host := req.URL.Host
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+
+	switch {
+	case err != nil && req.Context().Err() == nil:
+		l.decrease(req.Context(), host, aimdBackoffRatio, "transport error")
+	case err != nil:
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		l.decrease(req.Context(), host, aimdBackoffRatio, resp.Status)
+	case l.baseline > 0 && float64(latency) > float64(l.baseline)*l.cfg.LatencyFactor:
+		l.decrease(req.Context(), host, aimdLatencyBackoffRatio, "latency "+latency.Round(time.Millisecond).String())
+	default:
+		if l.baseline == 0 {
+			l.baseline = latency
+		} else {
+			l.baseline += time.Duration(aimdBaselineWeight * float64(latency-l.baseline))
+		}
+		if resp.StatusCode == http.StatusOK {
+			l.limit = min(l.limit+1/l.limit, float64(l.cfg.Max))
+		}
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// decrease must be called with l.mu held. Decreases are rate limited so that
+// a burst of failures from requests sent under the old limit only counts once.
+func (l *aimdLimiter) decrease(ctx context.Context, host string, ratio float64, reason string) {
+	now := l.now()
+	if now.Sub(l.lastDecrease) < aimdCooldown {
+		return
+	}
+	l.lastDecrease = now
+	l.limit = max(l.limit*ratio, float64(l.cfg.Min))
+	logging.FromContext(ctx).Warn("concurrency limit lowered", "host", host, "reason", reason, "limit", int(l.limit))
+}
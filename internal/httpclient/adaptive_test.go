@@ -0,0 +1,153 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNewAIMDLimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Concurrency
+		want Concurrency
+	}{
+		{name: "defaults", cfg: Concurrency{Max: 8}, want: Concurrency{Min: 1, Max: 8, Initial: 1, LatencyFactor: 2}},
+		{name: "as given", cfg: Concurrency{Min: 2, Max: 8, Initial: 4, LatencyFactor: 3}, want: Concurrency{Min: 2, Max: 8, Initial: 4, LatencyFactor: 3}},
+		{name: "min above max", cfg: Concurrency{Min: 10, Max: 8, Initial: 4}, want: Concurrency{Min: 8, Max: 8, Initial: 8, LatencyFactor: 2}},
+		{name: "initial above max", cfg: Concurrency{Min: 2, Max: 8, Initial: 20}, want: Concurrency{Min: 2, Max: 8, Initial: 2, LatencyFactor: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newAIMDLimiter(tt.cfg)
+			if l.cfg != tt.want {
+				t.Errorf("cfg = %+v, want %+v", l.cfg, tt.want)
+			}
+			if l.limit != float64(tt.want.Initial) {
+				t.Errorf("limit = %v, want %d", l.limit, tt.want.Initial)
+			}
+		})
+	}
+
+	if l := newAIMDLimiter(Concurrency{}); l != nil {
+		t.Errorf("newAIMDLimiter() without Max = %+v, want nil", l)
+	}
+}
+
+// outcome is the result of one request released to an aimdLimiter.
+type outcome struct {
+	status  int
+	err     error
+	latency time.Duration
+	after   time.Duration // advance the clock by this much first
+}
+
+func ok(latency time.Duration) outcome { return outcome{status: http.StatusOK, latency: latency} }
+
+func TestAIMDLimiter(t *testing.T) {
+	const ms = time.Millisecond
+	cfg := Concurrency{Min: 2, Max: 6, Initial: 4, LatencyFactor: 2}
+	tests := []struct {
+		name     string
+		outcomes []outcome
+		want     float64
+	}{
+		{name: "additive increase", outcomes: repeat(ok(10*ms), 5), want: increased(4, 5)},
+		{name: "ceiling", outcomes: repeat(ok(10*ms), 100), want: 6},
+		{name: "other statuses hold", outcomes: []outcome{{status: http.StatusNotFound, latency: 10 * ms}}, want: 4},
+		{name: "rate limited", outcomes: []outcome{{status: http.StatusTooManyRequests}}, want: 2},
+		{name: "server error", outcomes: []outcome{{status: http.StatusBadGateway}}, want: 2},
+		{name: "transport error", outcomes: []outcome{{err: syscall.ECONNRESET}}, want: 2},
+		{name: "floor", outcomes: []outcome{{status: 503}, {status: 503, after: time.Second}, {status: 503, after: time.Second}}, want: 2},
+		{name: "cooldown", outcomes: []outcome{{status: 503}, {status: 503, after: 999 * ms}}, want: 2},
+		{
+			name:     "after cooldown",
+			outcomes: []outcome{ok(10 * ms), ok(10 * ms), ok(10 * ms), ok(10 * ms), {status: 503}, {status: 503, after: time.Second}},
+			want:     2,
+		},
+		{name: "slow response", outcomes: []outcome{ok(10 * ms), ok(25 * ms)}, want: increased(4, 1) * 0.75},
+		{name: "latency within factor", outcomes: []outcome{ok(10 * ms), ok(20 * ms)}, want: increased(4, 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newAIMDLimiter(cfg)
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			l.now = func() time.Time { return now }
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, o := range tt.outcomes {
+				now = now.Add(o.after)
+				if err := l.acquire(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				var resp *http.Response
+				if o.err == nil {
+					resp = &http.Response{StatusCode: o.status, Status: http.StatusText(o.status)}
+				}
+				l.release(req, resp, o.err, o.latency)
+			}
+			if diff := l.limit - tt.want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("limit = %v, want %v", l.limit, tt.want)
+			}
+			if l.inFlight != 0 {
+				t.Errorf("inFlight = %d after releasing every request", l.inFlight)
+			}
+		})
+	}
+}
+
+// increased returns limit after n successful responses, each adding 1/limit
+// so that the limit grows by about one per round of requests.
+func increased(limit float64, n int) float64 {
+	for range n {
+		limit += 1 / limit
+	}
+	return limit
+}
+
+func repeat(o outcome, n int) []outcome {
+	outcomes := make([]outcome, n)
+	for i := range outcomes {
+		outcomes[i] = o
+	}
+	return outcomes
+}
+
+func TestAIMDLimiterAcquire(t *testing.T) {
+	l := newAIMDLimiter(Concurrency{Min: 1, Max: 2, Initial: 2})
+	for range 2 {
+		if err := l.acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("acquire() over the limit = %v, want %v", err, context.Canceled)
+	}
+
+	acquired := make(chan error)
+	go func() { acquired <- l.acquire(context.Background()) }()
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.release(req, &http.Response{StatusCode: http.StatusOK}, nil, time.Millisecond)
+	if err := <-acquired; err != nil {
+		t.Errorf("acquire() after a release = %v", err)
+	}
+
+	// Requests cancelled by the caller say nothing about the server.
+	canceledReq := req.WithContext(ctx)
+	l.release(canceledReq, nil, context.Canceled, 0)
+	if l.limit != 2 {
+		t.Errorf("limit after a cancelled request = %v, want 2", l.limit)
+	}
+}
@@ -0,0 +1,153 @@
+package httpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Chaos is an http.RoundTripper that injects faults in front of Base. Each
+// rate is the probability, between 0 and 1, that a request is hit by that
+// fault; at most one fault besides latency is injected per request.
+type Chaos struct {
+	Base http.RoundTripper
+
+	// Latency is the upper bound of a random delay added to every request.
+	Latency time.Duration
+	// ResetRate fails the request with a connection reset.
+	ResetRate float64
+	// StatusRate answers with a 429 or 500 without calling Base.
+	StatusRate float64
+	// HTMLRate answers 200 with an HTML error page instead of JSON.
+	HTMLRate float64
+	// TruncateRate cuts the response body in half and fails the read.
+	TruncateRate float64
+}
+
+// DefaultChaos is used by ParseChaos for the "default" spec.
+var DefaultChaos = Chaos{
+	Latency:      2 * time.Second,
+	ResetRate:    0.03,
+	StatusRate:   0.05,
+	HTMLRate:     0.02,
+	TruncateRate: 0.02,
+}
+
+const chaosErrorPage = `<!DOCTYPE html>
+<html><head><title>502 Bad Gateway</title></head>
+<body><center><h1>502 Bad Gateway</h1></center><hr><center>nginx</center></body>
+</html>
+`
+
+// ParseChaos parses a comma separated list of fault settings such as
+// "latency=500ms,reset=0.05,status=0.1,html=0.05,truncate=0.05". The spec
+// "default" returns DefaultChaos.
+func ParseChaos(spec string) (*Chaos, error) {
+	c := &Chaos{}
+	if spec == "default" {
+		*c = DefaultChaos
+		return c, nil
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid chaos setting %q: expected key=value", entry)
+		}
+		if key == "latency" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid chaos latency %q: %v", value, err)
+			}
+			c.Latency = d
+			continue
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid chaos rate %q for %s: expected a number between 0 and 1", value, key)
+		}
+		switch key {
+		case "reset":
+			c.ResetRate = rate
+		case "status":
+			c.StatusRate = rate
+		case "html":
+			c.HTMLRate = rate
+		case "truncate":
+			c.TruncateRate = rate
+		default:
+			return nil, fmt.Errorf("unknown chaos setting %q", key)
+		}
+	}
+	return c, nil
+}
+
+func (c *Chaos) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c.Latency > 0 {
+		timer := time.NewTimer(time.Duration(rand.Float64() * float64(c.Latency)))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	roll := rand.Float64()
+	switch {
+	case roll < c.ResetRate:
+		return nil, fmt.Errorf("[Chaos] read %s: %w", req.URL.Host, syscall.ECONNRESET)
+	case roll < c.ResetRate+c.StatusRate:
+		if rand.Float64() < 0.5 {
+			resp := chaosResponse(req, http.StatusTooManyRequests, "text/plain", "Too Many Requests\n")
+			resp.Header.Set("Retry-After", "1")
+			return resp, nil
+		}
+		return chaosResponse(req, http.StatusInternalServerError, "text/plain", "Internal Server Error\n"), nil
+	case roll < c.ResetRate+c.StatusRate+c.HTMLRate:
+		return chaosResponse(req, http.StatusOK, "text/html", chaosErrorPage), nil
+	}
+
+	base := c.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || roll >= c.ResetRate+c.StatusRate+c.HTMLRate+c.TruncateRate {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(io.MultiReader(
+		bytes.NewReader(body[:len(body)/2]),
+		errReader{io.ErrUnexpectedEOF},
+	))
+	resp.ContentLength = -1
+	return resp, nil
+}
+
+func chaosResponse(req *http.Request, status int, contentType, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {contentType}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
@@ -0,0 +1,127 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseChaos(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Chaos
+		wantErr bool
+	}{
+		{spec: "default", want: DefaultChaos},
+		{spec: "latency=1s", want: Chaos{Latency: time.Second}},
+		{
+			spec: "latency=500ms, reset=0.05,status=0.1,html=0.05,truncate=1",
+			want: Chaos{Latency: 500 * time.Millisecond, ResetRate: 0.05, StatusRate: 0.1, HTMLRate: 0.05, TruncateRate: 1},
+		},
+		{spec: "", wantErr: true},
+		{spec: "reset", wantErr: true},
+		{spec: "latency=soon", wantErr: true},
+		{spec: "status=1.5", wantErr: true},
+		{spec: "html=-0.1", wantErr: true},
+		{spec: "drop=0.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseChaos(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseChaos(%q) = %+v, want an error", tt.spec, *got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseChaos(%q) error = %v", tt.spec, err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParseChaos(%q) = %+v, want %+v", tt.spec, *got, tt.want)
+			}
+		})
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestChaos(t *testing.T) {
+	const body = `{"items":[1,2,3,4]}`
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return chaosResponse(req, http.StatusOK, "application/json", body), nil
+	})
+
+	tests := []struct {
+		name        string
+		chaos       Chaos
+		wantErr     error
+		wantStatus  []int
+		wantType    string
+		wantBody    string
+		wantReadErr error
+	}{
+		{name: "none", wantStatus: []int{http.StatusOK}, wantType: "application/json", wantBody: body},
+		{name: "reset", chaos: Chaos{ResetRate: 1}, wantErr: syscall.ECONNRESET},
+		{
+			name:       "status",
+			chaos:      Chaos{StatusRate: 1},
+			wantStatus: []int{http.StatusTooManyRequests, http.StatusInternalServerError},
+			wantType:   "text/plain",
+		},
+		{name: "html", chaos: Chaos{HTMLRate: 1}, wantStatus: []int{http.StatusOK}, wantType: "text/html", wantBody: chaosErrorPage},
+		{
+			name:        "truncate",
+			chaos:       Chaos{TruncateRate: 1},
+			wantStatus:  []int{http.StatusOK},
+			wantType:    "application/json",
+			wantBody:    body[:len(body)/2],
+			wantReadErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.chaos
+			c.Base = base
+			req, err := http.NewRequest(http.MethodGet, "http://example.com/items", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := c.RoundTrip(req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("RoundTrip() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+			defer resp.Body.Close()
+			if !slices.Contains(tt.wantStatus, resp.StatusCode) {
+				t.Errorf("status = %d, want one of %v", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			got, err := io.ReadAll(resp.Body)
+			if !errors.Is(err, tt.wantReadErr) {
+				t.Errorf("reading body: error = %v, want %v", err, tt.wantReadErr)
+			}
+			if tt.wantBody != "" && string(got) != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "" {
+				t.Error("429 response without Retry-After")
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package httpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/metrics"
+)
+
+// Options configures a Client. Timeout applies to every attempt separately.
+// Transport replaces the default network transport, e.g. with a Recorder.
+type Options struct {
+	Transport   http.RoundTripper
+	Timeout     time.Duration
+	Retry       RetryPolicy
+	RateLimit   RateLimit
+	Concurrency Concurrency
+}
+
+// Client wraps http.Client with the retry, rate limiting and adaptive
+// concurrency behaviour shared by all store scrapers. Scrapers call Do exactly
+// like they would on http.Client.
+type Client struct {
+	HTTP      *http.Client
+	Retry     RetryPolicy
+	RateLimit RateLimit
+	limiter   *aimdLimiter
+}
+
+// New returns a Client using the connection pool settings tuned for the store
+// APIs.
+func New(opts Options) *Client {
+	transport := opts.Transport
+	if transport == nil {
+		transport = NewTransport()
+	}
+	return &Client{
+		HTTP: &http.Client{
+			Timeout:   opts.Timeout,
+			Transport: transport,
+		},
+		Retry:     opts.Retry,
+		RateLimit: opts.RateLimit,
+		limiter:   newAIMDLimiter(opts.Concurrency),
+	}
+}
+
+// NewTransport returns the network transport used when Options.Transport is
+// not set.
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		MaxConnsPerHost:     75,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		DisableKeepAlives:   false,
+	}
+}
+
+// Do sends req, retrying timeouts, 429 and 5xx responses according to
+// c.Retry. The returned response is never a retryable one unless the attempt
+// budget ran out, in which case the last response is returned as is.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	return c.Retry.do(req, c.attempt)
+}
+
+// attempt sends req once, holding a slot of the adaptive limiter until the
+// response headers arrive. The rate limit wait happens before the clock
+// starts so that queueing for a token is not mistaken for server latency.
+func (c *Client) attempt(req *http.Request) (*http.Response, error) {
+	if err := limiterFor(req.URL.Host, c.RateLimit).Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	if c.limiter != nil {
+		if err := c.limiter.acquire(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	resp, err := c.HTTP.Do(req)
+	elapsed := time.Since(start)
+	metrics.ObserveRequest(req, resp, err, elapsed.Seconds())
+	if c.limiter != nil {
+		c.limiter.release(req, resp, err, elapsed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bufferBody(req, resp)
+}
+
+// bufferBody reads the whole response body so that a connection dropped
+// halfway through a page fails the attempt, and gets retried, instead of
+// surfacing as a parse error in the scraper.
+func bufferBody(req *http.Request, resp *http.Response) (*http.Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("[HTTP] error reading response body of %s: %w", req.URL, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
@@ -0,0 +1,102 @@
+package httpclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit is a token bucket: RequestsPerSecond tokens are added per second
+// up to Burst. A zero RequestsPerSecond disables limiting.
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+func (l RateLimit) limit() rate.Limit {
+	if l.RequestsPerSecond <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(l.RequestsPerSecond)
+}
+
+func (l RateLimit) burst() int {
+	return max(l.Burst, 1)
+}
+
+// Limiters are shared by host across all clients, so stores living on the
+// same API host (e.g. several zakaz.ua chains) share one budget.
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]*rate.Limiter{}
+	overrides  = map[string]RateLimit{}
+)
+
+// SetRateLimit overrides the rate limit of host for every client, taking
+// precedence over the per-store default passed in Options.
+func SetRateLimit(host string, l RateLimit) {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	overrides[host] = l
+	if lim, ok := limiters[host]; ok {
+		lim.SetLimit(l.limit())
+		lim.SetBurst(l.burst())
+	}
+}
+
+// ParseRateLimits parses a comma separated list of host=rps[:burst] entries,
+// e.g. "varus.ua=5:10,www.atbmarket.com=2". A rate of 0 disables limiting the
+// host; negative values and hosts listed twice are rejected.
+func ParseRateLimits(s string) (map[string]RateLimit, error) {
+	result := make(map[string]RateLimit)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, spec, ok := strings.Cut(entry, "=")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid rate limit %q: expected host=rps[:burst]", entry)
+		}
+		rpsStr, burstStr, hasBurst := strings.Cut(spec, ":")
+		rps, err := strconv.ParseFloat(rpsStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %q: %v", entry, err)
+		}
+		if !(rps >= 0) { // also catches NaN
+			return nil, fmt.Errorf("invalid rate limit %q: expected a rate of 0 or more", entry)
+		}
+		l := RateLimit{RequestsPerSecond: rps, Burst: 1}
+		if hasBurst {
+			if l.Burst, err = strconv.Atoi(burstStr); err != nil {
+				return nil, fmt.Errorf("invalid rate limit %q: %v", entry, err)
+			}
+			if l.Burst < 0 {
+				return nil, fmt.Errorf("invalid rate limit %q: negative burst", entry)
+			}
+		}
+		if _, ok := result[host]; ok {
+			return nil, fmt.Errorf("duplicate rate limit for host %q", host)
+		}
+		result[host] = l
+	}
+	return result, nil
+}
+
+func limiterFor(host string, def RateLimit) *rate.Limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	if lim, ok := limiters[host]; ok {
+		return lim
+	}
+	l, ok := overrides[host]
+	if !ok {
+		l = def
+	}
+	lim := rate.NewLimiter(l.limit(), l.burst())
+	limiters[host] = lim
+	return lim
+}
@@ -0,0 +1,86 @@
+package httpclient
+
+import (
+	"maps"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]RateLimit
+		wantErr bool
+	}{
+		{spec: "", want: map[string]RateLimit{}},
+		{spec: "varus.ua=5", want: map[string]RateLimit{"varus.ua": {RequestsPerSecond: 5, Burst: 1}}},
+		{
+			spec: " varus.ua=5:10 , www.atbmarket.com=0.5,",
+			want: map[string]RateLimit{
+				"varus.ua":          {RequestsPerSecond: 5, Burst: 10},
+				"www.atbmarket.com": {RequestsPerSecond: 0.5, Burst: 1},
+			},
+		},
+		{spec: "silpo.ua=0", want: map[string]RateLimit{"silpo.ua": {RequestsPerSecond: 0, Burst: 1}}},
+		{spec: "varus.ua", wantErr: true},
+		{spec: "=5", wantErr: true},
+		{spec: "varus.ua=fast", wantErr: true},
+		{spec: "varus.ua=5:many", wantErr: true},
+		{spec: "varus.ua=-1", wantErr: true},
+		{spec: "varus.ua=NaN", wantErr: true},
+		{spec: "varus.ua=5:-2", wantErr: true},
+		{spec: "varus.ua=5,varus.ua=2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseRateLimits(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseRateLimits(%q) = %v, want an error", tt.spec, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRateLimits(%q) error = %v", tt.spec, err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("ParseRateLimits(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	def := RateLimit{RequestsPerSecond: 4, Burst: 8}
+	tests := []struct {
+		name      string
+		host      string
+		override  *RateLimit
+		setBefore bool // override before the host's limiter is created
+		wantLimit rate.Limit
+		wantBurst int
+	}{
+		{name: "default", host: "default.test", wantLimit: 4, wantBurst: 8},
+		{name: "before", host: "before.test", override: &RateLimit{RequestsPerSecond: 2, Burst: 3}, setBefore: true, wantLimit: 2, wantBurst: 3},
+		{name: "after", host: "after.test", override: &RateLimit{RequestsPerSecond: 2, Burst: 3}, wantLimit: 2, wantBurst: 3},
+		{name: "unlimited", host: "unlimited.test", override: &RateLimit{}, wantLimit: rate.Inf, wantBurst: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.override != nil && tt.setBefore {
+				SetRateLimit(tt.host, *tt.override)
+			}
+			lim := limiterFor(tt.host, def)
+			if tt.override != nil && !tt.setBefore {
+				SetRateLimit(tt.host, *tt.override)
+			}
+			if lim != limiterFor(tt.host, def) {
+				t.Error("limiterFor() returned a new limiter for the same host")
+			}
+			if lim.Limit() != tt.wantLimit || lim.Burst() != tt.wantBurst {
+				t.Errorf("limiter = %v/s burst %d, want %v/s burst %d", lim.Limit(), lim.Burst(), tt.wantLimit, tt.wantBurst)
+			}
+		})
+	}
+}
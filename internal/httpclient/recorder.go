@@ -0,0 +1,153 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// RecorderMode selects whether a Recorder talks to the network.
+type RecorderMode int
+
+const (
+	// ModeRecord sends requests through Base and saves every response.
+	ModeRecord RecorderMode = iota
+	// ModeReplay serves saved responses and never touches the network.
+	ModeReplay
+)
+
+// recordedHeaders are the response headers kept in fixtures; everything else
+// (cookies, dates, tracing ids) only makes fixture diffs noisy.
+var recordedHeaders = []string{"Content-Type", "Retry-After", "Location"}
+
+// Recorder is an http.RoundTripper that records responses to Dir or replays
+// them from there. Each response is stored as a pair of files named after the
+// request: <name>.json with the status and headers and <name>.body with the
+// raw body, so API changes show up as readable diffs.
+type Recorder struct {
+	Dir  string
+	Mode RecorderMode
+	Base http.RoundTripper
+
+	mu sync.Mutex
+}
+
+type fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := fixtureName(req)
+	if r.Mode == ModeReplay {
+		return r.replay(req, name)
+	}
+
+	base := r.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := r.save(req, resp, name, body); err != nil {
+		return nil, fmt.Errorf("[Recorder] error saving fixture for %s: %w", req.URL, err)
+	}
+	return resp, nil
+}
+
+func (r *Recorder) save(req *http.Request, resp *http.Response, name string, body []byte) error {
+	f := fixture{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: http.Header{},
+	}
+	for _, h := range recordedHeaders {
+		if v := resp.Header.Values(h); len(v) > 0 {
+			f.Header[h] = v
+		}
+	}
+	meta, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	path := filepath.Join(r.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".json", append(meta, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(path+".body", body, 0o644)
+}
+
+func (r *Recorder) replay(req *http.Request, name string) (*http.Response, error) {
+	path := filepath.Join(r.Dir, name)
+	meta, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("[Recorder] no fixture for %s %s: %w", req.Method, req.URL, err)
+	}
+	var f fixture
+	if err := json.Unmarshal(meta, &f); err != nil {
+		return nil, fmt.Errorf("[Recorder] invalid fixture %s: %w", path, err)
+	}
+	body, err := os.ReadFile(path + ".body")
+	if err != nil {
+		return nil, fmt.Errorf("[Recorder] missing body of fixture %s: %w", path, err)
+	}
+	if f.Header == nil {
+		f.Header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// fixtureName builds a readable, filesystem safe name from the request host
+// and path, suffixed with a hash of the full request line so that requests
+// differing only in query parameters get their own fixture.
+func fixtureName(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.String()))
+	path := strings.Trim(req.URL.EscapedPath(), "/")
+	path = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, path)
+	if len(path) > 100 {
+		path = path[len(path)-100:]
+	}
+	return filepath.Join(req.URL.Host, path+"-"+hex.EncodeToString(sum[:6]))
+}
@@ -0,0 +1,110 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/logging"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/metrics"
+)
+
+// RetryPolicy controls how many times a request is attempted and how long to
+// wait in between. Waits grow exponentially from BaseDelay up to MaxDelay with
+// full jitter; a Retry-After header from the server takes precedence but is
+// still capped by MaxDelay.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func (p RetryPolicy) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	attempts := max(p.MaxAttempts, 1)
+	logger := logging.FromContext(req.Context())
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("[HTTP] error rewinding request body: %w", err)
+			}
+			req.Body = body
+		}
+
+		resp, err := send(req)
+		if attempt >= attempts || !retryable(req.Context(), resp, err) {
+			return resp, err
+		}
+
+		metrics.HTTPRetries.WithLabelValues(metrics.Store(req.Context())).Inc()
+		wait := p.backoff(attempt)
+		if resp != nil {
+			if ra, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = min(ra, p.MaxDelay)
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+			logger.Warn("retrying request", "url", req.URL.String(), "status", resp.StatusCode, "wait", wait, "attempt", attempt, "attempts", attempts)
+		} else {
+			logger.Warn("retrying request", "url", req.URL.String(), "error", err, "wait", wait, "attempt", attempt, "attempts", attempts)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a random wait in [0, min(MaxDelay, BaseDelay*2^(attempt-1))].
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,152 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		policy  RetryPolicy
+		attempt int
+		ceiling time.Duration
+	}{
+		{policy: p, attempt: 1, ceiling: 100 * time.Millisecond},
+		{policy: p, attempt: 2, ceiling: 200 * time.Millisecond},
+		{policy: p, attempt: 4, ceiling: 800 * time.Millisecond},
+		{policy: p, attempt: 5, ceiling: time.Second},
+		{policy: p, attempt: 80, ceiling: time.Second},
+		{policy: RetryPolicy{}, attempt: 3, ceiling: 0},
+	}
+	for _, tt := range tests {
+		var longest time.Duration
+		for range 1000 {
+			wait := tt.policy.backoff(tt.attempt)
+			if wait < 0 || wait > tt.ceiling {
+				t.Fatalf("%+v.backoff(%d) = %v, want within [0, %v]", tt.policy, tt.attempt, wait, tt.ceiling)
+			}
+			longest = max(longest, wait)
+		}
+		// Full jitter spreads waits over the whole range.
+		if longest < tt.ceiling/2 {
+			t.Errorf("%+v.backoff(%d) never exceeded %v in 1000 tries, want waits up to %v", tt.policy, tt.attempt, longest, tt.ceiling)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: "", wantOK: false},
+		{value: "0", want: 0, wantOK: true},
+		{value: "7", want: 7 * time.Second, wantOK: true},
+		{value: "-3", want: 0, wantOK: true},
+		{value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), want: 0, wantOK: true},
+		{value: "1.5", wantOK: false},
+		{value: "soon", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := retryAfter(tt.value)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// HTTP dates have a resolution of a second.
+	date := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	got, ok := retryAfter(date)
+	if !ok || got < 28*time.Second || got > 30*time.Second {
+		t.Errorf("retryAfter(%q) = %v, %v, want about 30s, true", date, got, ok)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status int
+		err    error
+		want   bool
+	}{
+		{name: "ok", status: http.StatusOK, want: false},
+		{name: "not found", status: http.StatusNotFound, want: false},
+		{name: "bad request", status: http.StatusBadRequest, want: false},
+		{name: "too many requests", status: http.StatusTooManyRequests, want: true},
+		{name: "internal server error", status: http.StatusInternalServerError, want: true},
+		{name: "bad gateway", status: http.StatusBadGateway, want: true},
+		{name: "service unavailable", status: http.StatusServiceUnavailable, want: true},
+		{name: "gateway timeout", status: http.StatusGatewayTimeout, want: true},
+		{name: "not implemented", status: http.StatusNotImplemented, want: false},
+		{name: "connection reset", err: syscall.ECONNRESET, want: true},
+		{name: "timeout", err: context.DeadlineExceeded, want: true},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "context done", ctx: canceled, status: http.StatusServiceUnavailable, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.status}
+			}
+			if got := retryable(ctx, resp, tt.err); got != tt.want {
+				t.Errorf("retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "success", maxAttempts: 3, failures: 0, wantAttempts: 1},
+		{name: "recovers", maxAttempts: 3, failures: 2, wantAttempts: 3},
+		{name: "gives up", maxAttempts: 3, failures: 5, wantAttempts: 3, wantErr: true},
+		{name: "single attempt", maxAttempts: 0, failures: 1, wantAttempts: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			send := func(req *http.Request) (*http.Response, error) {
+				attempts++
+				if attempts <= tt.failures {
+					return nil, syscall.ECONNRESET
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			}
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = RetryPolicy{MaxAttempts: tt.maxAttempts}.do(req, send)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, syscall.ECONNRESET)) {
+				t.Errorf("do() error = %v, want error %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("do() made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
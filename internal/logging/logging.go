@@ -0,0 +1,64 @@
+// Package logging sets up the slog logger shared by the scraper and the API
+// and carries request scoped attributes, such as the store being scraped or
+// the API request id, in the context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Setup makes a logger writing to stderr the default. level is one of
+// debug, info, warn or error and format is text or json; empty values mean
+// info and text.
+func Setup(level, format string) error {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q: %w", level, err)
+		}
+	}
+	handler, err := newHandler(os.Stderr, format, &slog.HandlerOptions{Level: lvl})
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// SetupFromEnv calls Setup with LOG_LEVEL and LOG_FORMAT.
+func SetupFromEnv() error {
+	return Setup(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+}
+
+func newHandler(w io.Writer, format string, opts *slog.HandlerOptions) (slog.Handler, error) {
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q: expected text or json", format)
+	}
+}
+
+type loggerKey struct{}
+
+// With returns a context whose logger adds args, given as for slog.Logger.With,
+// to every record.
+func With(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, loggerKey{}, FromContext(ctx).With(args...))
+}
+
+// FromContext returns the logger of ctx, the default logger if With was never
+// called on it.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
@@ -0,0 +1,128 @@
+// Package metrics holds the Prometheus metrics of the scraper. Requests are
+// labelled with the store they were made for, taken from the request context
+// (see WithStore).
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+var (
+	// HTTPRequests counts store requests per attempt by status code, or
+	// "error" for transport errors.
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_http_requests_total",
+		Help: "Requests sent to store APIs, per attempt.",
+	}, []string{"store", "code"})
+
+	// HTTPRequestDuration is the time until the response headers arrive.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scraper_http_request_duration_seconds",
+		Help:    "Latency of requests sent to store APIs, per attempt.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"store"})
+
+	HTTPRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_http_retries_total",
+		Help: "Store requests retried after a timeout, 429 or 5xx.",
+	}, []string{"store"})
+
+	// PagesFailed counts pages and products scrapers gave up on.
+	PagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_pages_failed_total",
+		Help: "Pages of products that failed to load after all retries or to parse, and products that failed to parse.",
+	}, []string{"store"})
+
+	ProductsScraped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_products_scraped_total",
+		Help: "Products scraped per store.",
+	}, []string{"store"})
+
+	ProductsDuplicated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_products_duplicated_total",
+		Help: "Listings of products already scraped in the same run, per store.",
+	}, []string{"store"})
+
+	StoreRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scraper_store_runs_total",
+		Help: "Store scrapes by outcome: succeeded, partial or failed.",
+	}, []string{"store", "status"})
+
+	StoreRunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scraper_store_run_duration_seconds",
+		Help:    "Time taken to scrape one store.",
+		Buckets: prometheus.ExponentialBuckets(10, 2, 9),
+	}, []string{"store"})
+
+	RunDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scraper_run_duration_seconds",
+		Help:    "Time taken by a scrape run over all stores.",
+		Buckets: prometheus.ExponentialBuckets(10, 2, 9),
+	})
+
+	// LastRunTimestamp is the end of the last run, for alerting on runs that
+	// stopped happening.
+	LastRunTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "scraper_last_run_timestamp_seconds",
+		Help: "Unix time the last scrape run finished.",
+	})
+)
+
+type storeKey struct{}
+
+// WithStore returns a context whose requests are counted against the store
+// with code.
+func WithStore(ctx context.Context, code string) context.Context {
+	return context.WithValue(ctx, storeKey{}, code)
+}
+
+// Store returns the store code set by WithStore, "unknown" if there is none.
+func Store(ctx context.Context) string {
+	if code, ok := ctx.Value(storeKey{}).(string); ok {
+		return code
+	}
+	return "unknown"
+}
+
+// ObserveRequest records one attempt of a store request.
+func ObserveRequest(req *http.Request, resp *http.Response, err error, seconds float64) {
+	store := Store(req.Context())
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	HTTPRequests.WithLabelValues(store, code).Inc()
+	HTTPRequestDuration.WithLabelValues(store).Observe(seconds)
+}
+
+// Serve exposes the metrics on addr at /metrics for the lifetime of the
+// process.
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	go func() {
+		slog.Info("serving metrics", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("error serving metrics", "error", err)
+		}
+	}()
+}
+
+// Push sends the metrics to the Prometheus Pushgateway at url under job, for
+// scrape runs that end before Prometheus gets to collect them.
+func Push(url, job string) error {
+	err := push.New(url, job).Gatherer(prometheus.DefaultGatherer).Push()
+	if err != nil {
+		return fmt.Errorf("error pushing metrics to %s: %w", url, err)
+	}
+	return nil
+}
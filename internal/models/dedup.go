@@ -0,0 +1,80 @@
+package models
+
+import "slices"
+
+// Dedup spots products of a store listed more than once in a run, e.g. in
+// overlapping categories. Listings are of the same product when they share
+// its store, branch and external id.
+type Dedup struct {
+	categories map[string][]string // listing key -> refs of its categories
+	duplicates int
+}
+
+// NewDedup returns an empty Dedup.
+func NewDedup() *Dedup {
+	return &Dedup{categories: make(map[string][]string)}
+}
+
+// Add records p and reports whether it is a duplicate of a product added
+// before and, if so, whether it is listed in a category the product was not
+// found in yet.
+func (d *Dedup) Add(p Product) (duplicate, newCategory bool) {
+	key := listingKey(p)
+	seen, duplicate := d.categories[key]
+	ref := p.Category().Ref
+	if !duplicate {
+		d.categories[key] = []string{ref}
+		return false, false
+	}
+
+	d.duplicates++
+	if slices.Contains(seen, ref) {
+		return true, false
+	}
+	d.categories[key] = append(seen, ref)
+	return true, true
+}
+
+// Duplicates returns the number of duplicates added.
+func (d *Dedup) Duplicates() int {
+	return d.duplicates
+}
+
+// listingKey identifies the listings of a product. The same product in
+// another branch is a listing of its own, with its own price.
+func listingKey(p Product) string {
+	return p.StoreCode + "\x00" + p.Branch + "\x00" + p.ExternalID
+}
+
+// Relisting returns p, a duplicate listed in a new category, as it is written
+// after the product's first listing: with the category moved from
+// CategoryPath to OtherCategoryPaths.
+func Relisting(p Product) Product {
+	p.OtherCategoryPaths = [][]CategoryRef{p.CategoryPath}
+	p.CategoryPath = nil
+	return p
+}
+
+// MergeListings folds later listings of a product, told apart like Dedup
+// does, into its first one, adding their categories to its
+// OtherCategoryPaths. The first listings are returned in their order.
+func MergeListings(products []Product) []Product {
+	first := make(map[string]int, len(products)) // listing key -> index in merged
+	merged := make([]Product, 0, len(products))
+	for _, p := range products {
+		key := listingKey(p)
+		i, ok := first[key]
+		if !ok {
+			first[key] = len(merged)
+			merged = append(merged, p)
+			continue
+		}
+		m := &merged[i]
+		for _, path := range p.CategoryPaths() {
+			if !slices.ContainsFunc(m.CategoryPaths(), func(other []CategoryRef) bool { return slices.Equal(other, path) }) {
+				m.OtherCategoryPaths = append(m.OtherCategoryPaths, path)
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func listing(branch, id, category string) Product {
+	return Product{
+		ExternalID:   id,
+		Branch:       branch,
+		StoreCode:    "metro",
+		CategoryPath: []CategoryRef{{Name: category, Ref: category}},
+	}
+}
+
+func TestDedup(t *testing.T) {
+	type result struct{ duplicate, newCategory bool }
+	tests := []struct {
+		name     string
+		products []Product
+		want     []result
+	}{
+		{
+			name:     "distinct products",
+			products: []Product{listing("", "1", "milk"), listing("", "2", "milk")},
+			want:     []result{{false, false}, {false, false}},
+		},
+		{
+			name:     "same category",
+			products: []Product{listing("", "1", "milk"), listing("", "1", "milk")},
+			want:     []result{{false, false}, {true, false}},
+		},
+		{
+			name:     "other category",
+			products: []Product{listing("", "1", "milk"), listing("", "1", "dairy"), listing("", "1", "dairy")},
+			want:     []result{{false, false}, {true, true}, {true, false}},
+		},
+		{
+			name:     "other branch",
+			products: []Product{listing("a", "1", "milk"), listing("b", "1", "dairy")},
+			want:     []result{{false, false}, {false, false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDedup()
+			var duplicates int
+			for i, p := range tt.products {
+				var got result
+				got.duplicate, got.newCategory = d.Add(p)
+				if got != tt.want[i] {
+					t.Errorf("Add(product %d) = %+v, want %+v", i, got, tt.want[i])
+				}
+				if got.duplicate {
+					duplicates++
+				}
+			}
+			if d.Duplicates() != duplicates {
+				t.Errorf("Duplicates() = %d, want %d", d.Duplicates(), duplicates)
+			}
+		})
+	}
+}
+
+// categories returns the leaf refs of p's category paths.
+func categories(p Product) []string {
+	var refs []string
+	for _, path := range p.CategoryPaths() {
+		refs = append(refs, path[len(path)-1].Ref)
+	}
+	return refs
+}
+
+func TestMergeListings(t *testing.T) {
+	tests := []struct {
+		name     string
+		products []Product
+		want     [][]string // categories of each merged product
+	}{
+		{
+			name:     "relistings",
+			products: []Product{listing("a", "1", "milk"), listing("a", "2", "milk"), Relisting(listing("a", "1", "dairy")), Relisting(listing("a", "1", "breakfast"))},
+			want:     [][]string{{"milk", "dairy", "breakfast"}, {"milk"}},
+		},
+		{
+			name:     "branches kept apart",
+			products: []Product{listing("a", "1", "milk"), listing("b", "1", "milk"), Relisting(listing("b", "1", "dairy"))},
+			want:     [][]string{{"milk"}, {"milk", "dairy"}},
+		},
+		{
+			name:     "full duplicates",
+			products: []Product{listing("a", "1", "milk"), listing("a", "1", "milk"), listing("a", "1", "dairy")},
+			want:     [][]string{{"milk", "dairy"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := MergeListings(tt.products)
+			if len(merged) != len(tt.want) {
+				t.Fatalf("MergeListings() = %d products, want %d", len(merged), len(tt.want))
+			}
+			for i, p := range merged {
+				if got := categories(p); !slices.Equal(got, tt.want[i]) {
+					t.Errorf("product %d categories = %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRelistingCSVRecord(t *testing.T) {
+	p := listing("a", "1", "dairy")
+	p.CategoryPath = []CategoryRef{{Name: "Food", Ref: "food"}, {Name: "Dairy", Ref: "dairy"}}
+	p.ScrapedAt = time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+	relisting := Relisting(p)
+
+	got, err := ParseCSVRecord(relisting.CSVRecord())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.CategoryPath) != 0 || len(got.OtherCategoryPaths) != 1 || !slices.Equal(got.OtherCategoryPaths[0], p.CategoryPath) {
+		t.Errorf("ParseCSVRecord(Relisting().CSVRecord()) paths = %v, %v, want none, %v", got.CategoryPath, got.OtherCategoryPaths, [][]CategoryRef{p.CategoryPath})
+	}
+}
@@ -0,0 +1,346 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// categoryPathSeparator joins CategoryPath elements when a product is
+// flattened into a single text column.
+const categoryPathSeparator = " > "
+
+// otherPathsSeparator joins OtherCategoryPaths in a single text column.
+const otherPathsSeparator = " | "
+
+// CSVHeader is the header row written before Product records.
+var CSVHeader = []string{"Name", "ExternalID", "URL", "Brand", "SKU", "EAN", "ImageURL", "Description", "Price", "RegularPrice", "PromoPrice", "PromoEndsAt", "Currency", "Unit", "Quantity", "QuantityUnit", "UnitPrice", "InStock", "StockQty", "Category", "CategoryRefs", "OtherCategories", "OtherCategoryRefs", "Store", "Branch", "BranchName", "Region", "ScrapedAt"}
+
+// CategoryRef is a store category, identified by the store's own id for it so
+// that renames do not create a new category.
+type CategoryRef struct {
+	Ref  string `json:"ref"`
+	Name string `json:"name"`
+}
+
+// Product is a single product offer as scraped from a store. Branch and
+// Region identify the shop or delivery area the price applies to for stores
+// that price per branch; both are empty otherwise. BranchName is the store's
+// name for the branch, when it has one.
+//
+// Brand, SKU (the store's article number), EAN (the barcode), ImageURL and
+// Description are filled in when the store lists them.
+//
+// Price is what the product costs at the time of scraping. RegularPrice is
+// the price without promotions and PromoPrice the discounted price, zero when
+// the product is not on sale. PromoEndsAt is zero when the store does not
+// say when the promotion ends.
+//
+// Quantity is the package size in QuantityUnit, one of the base units in
+// quantity.go, and UnitPrice is Price per QuantityUnit. All three are zero when
+// the package size is unknown.
+//
+// InStock and StockQty are nil when the store does not report availability
+// or the quantity left.
+//
+// OtherCategoryPaths are the categories besides CategoryPath the product was
+// listed in during the run. Sinks write a product as soon as its first
+// listing is scraped, so each further category follows in a relisting: a
+// copy of the product with the category moved from CategoryPath to
+// OtherCategoryPaths, see Relisting. MergeListings folds them back in.
+type Product struct {
+	Name               string          `json:"name"`
+	ExternalID         string          `json:"external_id"`
+	URL                string          `json:"url"`
+	Brand              string          `json:"brand,omitempty"`
+	SKU                string          `json:"sku,omitempty"`
+	EAN                string          `json:"ean,omitempty"`
+	ImageURL           string          `json:"image_url,omitempty"`
+	Description        string          `json:"description,omitempty"`
+	Price              float64         `json:"price"`
+	RegularPrice       float64         `json:"regular_price,omitzero"`
+	PromoPrice         float64         `json:"promo_price,omitzero"`
+	PromoEndsAt        time.Time       `json:"promo_ends_at,omitzero"`
+	Currency           string          `json:"currency"`
+	Unit               string          `json:"unit,omitempty"`
+	Quantity           float64         `json:"quantity,omitzero"`
+	QuantityUnit       string          `json:"quantity_unit,omitempty"`
+	UnitPrice          float64         `json:"unit_price,omitzero"`
+	InStock            *bool           `json:"in_stock,omitempty"`
+	StockQty           *float64        `json:"stock_qty,omitempty"`
+	CategoryPath       []CategoryRef   `json:"category_path"`
+	OtherCategoryPaths [][]CategoryRef `json:"other_category_paths,omitempty"`
+	StoreCode          string          `json:"store"`
+	Branch             string          `json:"branch,omitempty"`
+	BranchName         string          `json:"branch_name,omitempty"`
+	Region             string          `json:"region,omitempty"`
+	ScrapedAt          time.Time       `json:"scraped_at"`
+}
+
+// Category returns the most specific category the product was found in.
+func (p Product) Category() CategoryRef {
+	if len(p.CategoryPath) == 0 {
+		return CategoryRef{}
+	}
+	return p.CategoryPath[len(p.CategoryPath)-1]
+}
+
+// CategoryPaths returns CategoryPath followed by OtherCategoryPaths.
+func (p Product) CategoryPaths() [][]CategoryRef {
+	var paths [][]CategoryRef
+	if len(p.CategoryPath) > 0 {
+		paths = append(paths, p.CategoryPath)
+	}
+	return append(paths, p.OtherCategoryPaths...)
+}
+
+// quantity returns p.Quantity, nil when unknown.
+func (p Product) quantity() *float64 {
+	if p.Quantity == 0 {
+		return nil
+	}
+	return &p.Quantity
+}
+
+// OnSale reports whether the product is sold below its regular price.
+func (p Product) OnSale() bool {
+	return p.PromoPrice > 0 && p.PromoPrice < p.RegularPrice
+}
+
+// CSVRecord returns the product as a row matching CSVHeader.
+func (p Product) CSVRecord() []string {
+	return []string{
+		p.Name,
+		p.ExternalID,
+		p.URL,
+		p.Brand,
+		p.SKU,
+		p.EAN,
+		p.ImageURL,
+		p.Description,
+		formatPrice(p.Price),
+		formatPrice(p.RegularPrice),
+		formatPrice(p.PromoPrice),
+		formatTime(p.PromoEndsAt),
+		p.Currency,
+		p.Unit,
+		formatQty(p.quantity()),
+		p.QuantityUnit,
+		formatPrice(p.UnitPrice),
+		formatBool(p.InStock),
+		formatQty(p.StockQty),
+		joinCategoryPath(p.CategoryPath, func(c CategoryRef) string { return c.Name }),
+		joinCategoryPath(p.CategoryPath, func(c CategoryRef) string { return c.Ref }),
+		joinCategoryPaths(p.OtherCategoryPaths, func(c CategoryRef) string { return c.Name }),
+		joinCategoryPaths(p.OtherCategoryPaths, func(c CategoryRef) string { return c.Ref }),
+		p.StoreCode,
+		p.Branch,
+		p.BranchName,
+		p.Region,
+		formatTime(p.ScrapedAt),
+	}
+}
+
+// ParseCSVRecord is the inverse of Product.CSVRecord.
+func ParseCSVRecord(record []string) (Product, error) {
+	if len(record) != len(CSVHeader) {
+		return Product{}, fmt.Errorf("expected %d fields, got %d", len(CSVHeader), len(record))
+	}
+	col := func(name string) string {
+		return record[slices.Index(CSVHeader, name)]
+	}
+	price, err := parsePrice(col("Price"))
+	if err != nil {
+		return Product{}, fmt.Errorf("invalid price %q: %w", col("Price"), err)
+	}
+	regularPrice, err := parsePrice(col("RegularPrice"))
+	if err != nil {
+		return Product{}, fmt.Errorf("invalid regular price %q: %w", col("RegularPrice"), err)
+	}
+	promoPrice, err := parsePrice(col("PromoPrice"))
+	if err != nil {
+		return Product{}, fmt.Errorf("invalid promo price %q: %w", col("PromoPrice"), err)
+	}
+	promoEndsAt, err := parseTime(col("PromoEndsAt"))
+	if err != nil {
+		return Product{}, fmt.Errorf("invalid promo end %q: %w", col("PromoEndsAt"), err)
+	}
+	quantity, err := parseQty(col("Quantity"))
+	if err != nil {
+		return Product{}, fmt.Errorf("invalid quantity %q: %w", col("Quantity"), err)
+	}
+	unitPrice, err := parsePrice(col("UnitPrice"))
+	if err != nil {
+		return Product{}, fmt.Errorf("invalid unit price %q: %w", col("UnitPrice"), err)
+	}
+	inStock, err := parseBool(col("InStock"))
+	if err != nil {
+		return Product{}, fmt.Errorf("invalid in stock %q: %w", col("InStock"), err)
+	}
+	stockQty, err := parseQty(col("StockQty"))
+	if err != nil {
+		return Product{}, fmt.Errorf("invalid stock quantity %q: %w", col("StockQty"), err)
+	}
+	scrapedAt, err := time.Parse(time.RFC3339, col("ScrapedAt"))
+	if err != nil {
+		return Product{}, fmt.Errorf("invalid scraped at %q: %w", col("ScrapedAt"), err)
+	}
+	path, err := splitCategoryPath(col("Category"), col("CategoryRefs"))
+	if err != nil {
+		return Product{}, err
+	}
+	otherPaths, err := splitCategoryPaths(col("OtherCategories"), col("OtherCategoryRefs"))
+	if err != nil {
+		return Product{}, err
+	}
+	p := Product{
+		Name:               col("Name"),
+		ExternalID:         col("ExternalID"),
+		URL:                col("URL"),
+		Brand:              col("Brand"),
+		SKU:                col("SKU"),
+		EAN:                col("EAN"),
+		ImageURL:           col("ImageURL"),
+		Description:        col("Description"),
+		Price:              price,
+		RegularPrice:       regularPrice,
+		PromoPrice:         promoPrice,
+		PromoEndsAt:        promoEndsAt,
+		Currency:           col("Currency"),
+		Unit:               col("Unit"),
+		QuantityUnit:       col("QuantityUnit"),
+		UnitPrice:          unitPrice,
+		InStock:            inStock,
+		StockQty:           stockQty,
+		CategoryPath:       path,
+		OtherCategoryPaths: otherPaths,
+		StoreCode:          col("Store"),
+		Branch:             col("Branch"),
+		BranchName:         col("BranchName"),
+		Region:             col("Region"),
+		ScrapedAt:          scrapedAt,
+	}
+	if quantity != nil {
+		p.Quantity = *quantity
+	}
+	return p, nil
+}
+
+func joinCategoryPath(path []CategoryRef, field func(CategoryRef) string) string {
+	parts := make([]string, len(path))
+	for i, c := range path {
+		parts[i] = field(c)
+	}
+	return strings.Join(parts, categoryPathSeparator)
+}
+
+func splitCategoryPath(names, refs string) ([]CategoryRef, error) {
+	if names == "" && refs == "" {
+		return nil, nil
+	}
+	nameParts := strings.Split(names, categoryPathSeparator)
+	refParts := strings.Split(refs, categoryPathSeparator)
+	if len(nameParts) != len(refParts) {
+		return nil, fmt.Errorf("category path %q does not match category refs %q", names, refs)
+	}
+	path := make([]CategoryRef, len(nameParts))
+	for i := range nameParts {
+		path[i] = CategoryRef{Ref: refParts[i], Name: nameParts[i]}
+	}
+	return path, nil
+}
+
+func joinCategoryPaths(paths [][]CategoryRef, field func(CategoryRef) string) string {
+	parts := make([]string, len(paths))
+	for i, path := range paths {
+		parts[i] = joinCategoryPath(path, field)
+	}
+	return strings.Join(parts, otherPathsSeparator)
+}
+
+func splitCategoryPaths(names, refs string) ([][]CategoryRef, error) {
+	if names == "" && refs == "" {
+		return nil, nil
+	}
+	nameParts := strings.Split(names, otherPathsSeparator)
+	refParts := strings.Split(refs, otherPathsSeparator)
+	if len(nameParts) != len(refParts) {
+		return nil, fmt.Errorf("other categories %q do not match other category refs %q", names, refs)
+	}
+	paths := make([][]CategoryRef, len(nameParts))
+	for i := range nameParts {
+		path, err := splitCategoryPath(nameParts[i], refParts[i])
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = path
+	}
+	return paths, nil
+}
+
+// formatPrice leaves missing (zero) prices empty.
+func formatPrice(price float64) string {
+	if price == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
+
+func parsePrice(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func formatBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+func parseBool(s string) (*bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func formatQty(q *float64) string {
+	if q == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*q, 'f', -1, 64)
+}
+
+func parseQty(s string) (*float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	q, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Base units quantities are normalised to, so that unit prices compare across
+// stores.
+const (
+	UnitKilogram = "kg"
+	UnitLitre    = "l"
+	UnitPiece    = "pcs"
+)
+
+// Quantity is the amount of product sold for one price, in a base unit.
+type Quantity struct {
+	Amount float64
+	Unit   string
+}
+
+// unitFactors maps the unit spellings used by the stores to a base unit and
+// the factor converting to it.
+var unitFactors = map[string]Quantity{
+	"г":   {0.001, UnitKilogram},
+	"гр":  {0.001, UnitKilogram},
+	"g":   {0.001, UnitKilogram},
+	"кг":  {1, UnitKilogram},
+	"kg":  {1, UnitKilogram},
+	"мл":  {0.001, UnitLitre},
+	"ml":  {0.001, UnitLitre},
+	"л":   {1, UnitLitre},
+	"l":   {1, UnitLitre},
+	"шт":  {1, UnitPiece},
+	"pcs": {1, UnitPiece},
+}
+
+// quantityPattern matches amounts like "900г", "0,5 л" or "6х0.33л". Go
+// regexps have no Unicode word boundaries, hence the explicit non-letter
+// guards around the match.
+var quantityPattern = regexp.MustCompile(`(?i)(?:^|[^\p{L}\d.,])(?:(\d+)\s*[xх*×]\s*)?(\d+(?:[.,]\d+)?)\s*(кг|гр|г|мл|л|шт|kg|g|ml|l|pcs)\.?(?:[^\p{L}]|$)`)
+
+// ParseQuantity finds the quantity in s, e.g. a product name or a store's
+// package size field. When s mentions several, the last one wins, as names
+// end with the package size.
+func ParseQuantity(s string) (Quantity, bool) {
+	matches := quantityPattern.FindAllStringSubmatch(s, -1)
+	if len(matches) == 0 {
+		return Quantity{}, false
+	}
+	m := matches[len(matches)-1]
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(m[2], ",", "."), 64)
+	if err != nil || amount <= 0 {
+		return Quantity{}, false
+	}
+	if m[1] != "" {
+		count, err := strconv.Atoi(m[1])
+		if err != nil || count <= 0 {
+			return Quantity{}, false
+		}
+		amount *= float64(count)
+	}
+	unit := unitFactors[strings.ToLower(m[3])]
+	return Quantity{Amount: math.Round(amount*unit.Amount*1000) / 1000, Unit: unit.Unit}, true
+}
+
+// PerUnit returns the quantity of products sold by the unit, such as loose
+// vegetables priced per kilogram, when unit names one.
+func PerUnit(unit string) (Quantity, bool) {
+	q, ok := unitFactors[strings.ToLower(strings.TrimSpace(unit))]
+	if !ok || q.Amount != 1 {
+		return Quantity{}, false
+	}
+	return q, true
+}
+
+// SetQuantity records q as the quantity p is sold in and derives the price
+// per base unit from it.
+func (p *Product) SetQuantity(q Quantity) {
+	if q.Amount <= 0 {
+		return
+	}
+	p.Quantity = q.Amount
+	p.QuantityUnit = q.Unit
+	p.UnitPrice = math.Round(p.Price/q.Amount*100) / 100
+}
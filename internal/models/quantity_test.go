@@ -0,0 +1,55 @@
+package models
+
+import "testing"
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		s      string
+		want   Quantity
+		wantOK bool
+	}{
+		{s: "Молоко Яготинське 2,6% 900г", want: Quantity{0.9, UnitKilogram}, wantOK: true},
+		{s: "Сік Sandora 0,95 л", want: Quantity{0.95, UnitLitre}, wantOK: true},
+		{s: "Вода Моршинська 1.5л", want: Quantity{1.5, UnitLitre}, wantOK: true},
+		{s: "Пиво Оболонь 6х0.33л", want: Quantity{1.98, UnitLitre}, wantOK: true},
+		{s: "Йогурт 4*115 гр", want: Quantity{0.46, UnitKilogram}, wantOK: true},
+		{s: "Яйця курячі 10 шт.", want: Quantity{10, UnitPiece}, wantOK: true},
+		{s: "Борошно 2 КГ", want: Quantity{2, UnitKilogram}, wantOK: true},
+		{s: "Olive oil 500ml", want: Quantity{0.5, UnitLitre}, wantOK: true},
+		{s: "Набір 2 шт по 250г", want: Quantity{0.25, UnitKilogram}, wantOK: true},
+		{s: "Сир Гауда ваговий", wantOK: false},
+		{s: "Гель для прання 3 в 1", wantOK: false},
+		{s: "Кава 0 г", wantOK: false},
+		{s: "Сметана 20% клас", wantOK: false},
+		{s: "", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, ok := ParseQuantity(tt.s)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ParseQuantity(%q) = %v, %v, want %v, %v", tt.s, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPerUnit(t *testing.T) {
+	tests := []struct {
+		unit   string
+		want   Quantity
+		wantOK bool
+	}{
+		{unit: "кг", want: Quantity{1, UnitKilogram}, wantOK: true},
+		{unit: " ШТ ", want: Quantity{1, UnitPiece}, wantOK: true},
+		{unit: "г", wantOK: false},
+		{unit: "уп", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			got, ok := PerUnit(tt.unit)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("PerUnit(%q) = %v, %v, want %v, %v", tt.unit, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
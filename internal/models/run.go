@@ -0,0 +1,181 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// RunStatus is the state of a scrape run or of one store within it.
+type RunStatus string
+
+const (
+	RunRunning   RunStatus = "running"
+	RunSucceeded RunStatus = "succeeded"
+	// RunPartial means products were scraped but some requests failed.
+	RunPartial RunStatus = "partial"
+	RunFailed  RunStatus = "failed"
+	// RunSkipped means the store was left out because another run was
+	// already scraping it.
+	RunSkipped RunStatus = "skipped"
+)
+
+// maxErrorSamples caps the error messages kept per store run.
+const maxErrorSamples = 10
+
+// ScrapeRun is one run of the scrapers over a set of stores. ID is assigned
+// when the run is saved to the database and zero until then.
+type ScrapeRun struct {
+	ID         int64
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Status     RunStatus
+	Stores     []*StoreRun
+}
+
+// NewScrapeRun starts a run of the given stores.
+func NewScrapeRun(storeCodes []string) *ScrapeRun {
+	run := &ScrapeRun{StartedAt: time.Now(), Status: RunRunning}
+	for _, code := range storeCodes {
+		run.Stores = append(run.Stores, &StoreRun{StoreCode: code, Status: RunRunning})
+	}
+	return run
+}
+
+// Store returns the run of the store with code, nil if it is not part of the
+// run.
+func (r *ScrapeRun) Store(code string) *StoreRun {
+	for _, s := range r.Stores {
+		if s.StoreCode == code {
+			return s
+		}
+	}
+	return nil
+}
+
+// Finish stamps the end of the run and derives its status from the stores
+// that were not skipped: failed when every store failed, partial when any did
+// not fully succeed. A run whose stores were all skipped is skipped.
+func (r *ScrapeRun) Finish() {
+	r.FinishedAt = time.Now()
+	failed, skipped := 0, 0
+	r.Status = RunSucceeded
+	for _, s := range r.Stores {
+		switch s.Status {
+		case RunSkipped:
+			skipped++
+		case RunFailed:
+			failed++
+			r.Status = RunPartial
+		case RunPartial, RunRunning:
+			r.Status = RunPartial
+		}
+	}
+	switch {
+	case skipped == len(r.Stores):
+		r.Status = RunSkipped
+	case failed == len(r.Stores)-skipped:
+		r.Status = RunFailed
+	}
+}
+
+// Products returns the number of products scraped across all stores.
+func (r *ScrapeRun) Products() int {
+	var total int
+	for _, s := range r.Stores {
+		total += s.Products
+	}
+	return total
+}
+
+// Duplicates returns the number of duplicate products across all stores.
+func (r *ScrapeRun) Duplicates() int {
+	var total int
+	for _, s := range r.Stores {
+		total += s.Duplicates
+	}
+	return total
+}
+
+// Errors returns the number of errors across all stores.
+func (r *ScrapeRun) Errors() int {
+	var total int
+	for _, s := range r.Stores {
+		total += s.ErrorCount()
+	}
+	return total
+}
+
+// StoreRun is the part of a scrape run covering one store. Errors may be
+// recorded concurrently by the store's scraper goroutines. Duplicates counts
+// the listings of products already scraped in the run, which are merged into
+// the first one rather than counted as products.
+type StoreRun struct {
+	StoreCode  string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Status     RunStatus
+	Products   int
+	Duplicates int
+
+	mu           sync.Mutex
+	errors       int
+	errorSamples []string
+}
+
+// Start stamps the start of the store's scrape.
+func (s *StoreRun) Start() {
+	s.StartedAt = time.Now()
+	s.Status = RunRunning
+}
+
+// Finish stamps the end of the store's scrape with the number of products
+// scraped. A store without products failed; one with errors is partial.
+func (s *StoreRun) Finish(products int) {
+	s.FinishedAt = time.Now()
+	s.Products = products
+	switch {
+	case products == 0:
+		s.Status = RunFailed
+	case s.ErrorCount() > 0:
+		s.Status = RunPartial
+	default:
+		s.Status = RunSucceeded
+	}
+}
+
+// Skip stamps the store as left out of the run.
+func (s *StoreRun) Skip() {
+	s.StartedAt = time.Now()
+	s.FinishedAt = s.StartedAt
+	s.Status = RunSkipped
+}
+
+// AddError counts err against the store, keeping its message as a sample
+// while there is room.
+func (s *StoreRun) AddError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors++
+	if len(s.errorSamples) < maxErrorSamples {
+		s.errorSamples = append(s.errorSamples, err.Error())
+	}
+}
+
+// RecordFailure implements scrapers.FailureRecorder.
+func (s *StoreRun) RecordFailure(err error) {
+	s.AddError(err)
+}
+
+// ErrorCount returns the number of errors recorded so far.
+func (s *StoreRun) ErrorCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.errors
+}
+
+// ErrorSamples returns up to maxErrorSamples of the recorded error messages.
+func (s *StoreRun) ErrorSamples() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.errorSamples...)
+}
@@ -4,40 +4,50 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/httpclient"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/logging"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/models"
 	"github.com/MrPuls/groceries-price-aggregator-go/internal/utils"
 	"golang.org/x/net/html"
 )
 
 const (
-	atbBaseUrl       = "https://www.atbmarket.com"
+	atbBaseURL       = "https://www.atbmarket.com"
 	atbSemaphoreSize = 35
 )
 
+var (
+	atbRetryPolicy = httpclient.RetryPolicy{MaxAttempts: 3, BaseDelay: 2 * time.Second, MaxDelay: time.Minute}
+	atbRateLimit   = httpclient.RateLimit{RequestsPerSecond: 4, Burst: 8}
+	atbConcurrency = httpclient.Concurrency{Min: 2, Initial: 8, Max: atbSemaphoreSize}
+)
+
 type AtbScraper struct {
-	Client  *http.Client
+	Client  *httpclient.Client
 	Headers map[string]string
+	BaseURL string
 }
 
-func NewAtbScraper() *AtbScraper {
+func init() {
+	Register("atb", func(opts Options) (Scraper, error) { return NewAtbScraper(opts), nil })
+}
+
+func NewAtbScraper(opts Options) *AtbScraper {
 	return &AtbScraper{
-		Client: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				MaxConnsPerHost:     75,
-				IdleConnTimeout:     90 * time.Second,
-				TLSHandshakeTimeout: 10 * time.Second,
-				DisableKeepAlives:   false,
-			},
-		},
+		Client: httpclient.New(httpclient.Options{
+			Transport:   opts.Transport,
+			Timeout:     30 * time.Second,
+			Retry:       atbRetryPolicy,
+			RateLimit:   atbRateLimit,
+			Concurrency: atbConcurrency,
+		}),
 		Headers: map[string]string{
 			"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:140.0) Gecko/20100101 Firefox/140.0",
 			"Accept":          "*/*",
@@ -52,6 +62,7 @@ func NewAtbScraper() *AtbScraper {
 			"Host":            "www.atbmarket.com",
 			"Referer":         "https://www.atbmarket.com/",
 		},
+		BaseURL: opts.baseURL("atb", atbBaseURL),
 	}
 }
 
@@ -68,7 +79,7 @@ func (a *AtbScraper) getHTML(ctx context.Context, url string) (*html.Node, error
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("[Metro] getting categories: status code %d", resp.StatusCode)
+		return nil, fmt.Errorf("[Atb] getting %s: status code %d", url, resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -138,6 +149,17 @@ func getTextContent(n *html.Node) string {
 	return strings.TrimSpace(text.String())
 }
 
+// childElements returns the direct children of n that are tag elements.
+func childElements(n *html.Node, tag string) []*html.Node {
+	var result []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == tag {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
 func findHref(n *html.Node) string {
 	if n == nil {
 		return ""
@@ -190,8 +212,12 @@ func findAttrValue(n *html.Node, tag, class, attr string) string {
 	return ""
 }
 
-func (a *AtbScraper) GetCategories(ctx context.Context) ([]string, error) {
-	doc, err := a.getHTML(ctx, atbBaseUrl)
+func (a *AtbScraper) Name() string { return "Atb" }
+
+func (a *AtbScraper) Code() string { return "atb" }
+
+func (a *AtbScraper) GetCategories(ctx context.Context) ([]Category, error) {
+	doc, err := a.getHTML(ctx, a.BaseURL)
 	if err != nil {
 		return nil, err
 	}
@@ -199,27 +225,56 @@ func (a *AtbScraper) GetCategories(ctx context.Context) ([]string, error) {
 	if menu == nil {
 		return nil, fmt.Errorf("category menu not found")
 	}
-	menuItems := findAllNodesByClass(menu, "li", "category-menu__item")
-	var categories []string
-	for _, item := range menuItems {
-		href := findHref(item)
-		if href != "" {
-			categories = append(categories, atbBaseUrl+href)
+	var categories []Category
+	walkCategoryTree(atbMenuItems(menu),
+		func(item *html.Node) (models.CategoryRef, []*html.Node) {
+			var children []*html.Node
+			for _, submenu := range childElements(item, "ul") {
+				children = append(children, atbMenuItems(submenu)...)
+			}
+			return atbMenuCategory(item), children
+		},
+		func(item *html.Node, path []models.CategoryRef) {
+			c := atbMenuCategory(item)
+			if c.Ref == "" {
+				return
+			}
+			categories = append(categories, Category{Slug: c.Ref, Name: c.Name, URL: a.BaseURL + c.Ref, Path: path})
+		})
+	return categories, nil
+}
+
+// atbMenuItems returns the items of a level of the category menu.
+func atbMenuItems(menu *html.Node) []*html.Node {
+	var items []*html.Node
+	for _, li := range childElements(menu, "li") {
+		for _, attr := range li.Attr {
+			if attr.Key == "class" && strings.Contains(attr.Val, "category-menu__item") {
+				items = append(items, li)
+				break
+			}
 		}
 	}
-	return categories, nil
+	return items
 }
 
-func (a *AtbScraper) GetProducts(ctx context.Context, cts []string) ([][]string, error) {
+// atbMenuCategory returns the category a menu item links to, identified by
+// its catalog path.
+func atbMenuCategory(item *html.Node) models.CategoryRef {
+	links := childElements(item, "a")
+	if len(links) == 0 {
+		return models.CategoryRef{}
+	}
+	return models.CategoryRef{Ref: findHref(links[0]), Name: getTextContent(links[0])}
+}
 
-	var result [][]string
+func (a *AtbScraper) GetProducts(ctx context.Context, cts []Category, out chan<- models.Product) error {
 	var wg sync.WaitGroup
 	httpSemaphore := make(chan struct{}, atbSemaphoreSize)
-	resultsChan := make(chan []string)
 
 	for _, category := range cts {
 		wg.Add(1)
-		go func(category string) {
+		go func(category Category) {
 			httpSemaphore <- struct{}{}
 			defer func() { <-httpSemaphore }()
 			defer wg.Done()
@@ -228,44 +283,38 @@ func (a *AtbScraper) GetProducts(ctx context.Context, cts []string) ([][]string,
 				return
 			default:
 			}
-			a.fetchProducts(ctx, category, nil, resultsChan)
+			a.fetchProducts(ctx, category, nil, out)
 		}(category)
 	}
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
-
-	for product := range resultsChan {
-		result = append(result, product)
-	}
+	wg.Wait()
 
-	return result, nil
+	return nil
 }
 
-func (a *AtbScraper) fetchProducts(ctx context.Context, urlStr string, page *int, resultChan chan []string) {
-	requestURL := urlStr
+func (a *AtbScraper) fetchProducts(ctx context.Context, category Category, page *int, resultChan chan<- models.Product) {
+	requestURL := category.URL
 	var wg sync.WaitGroup
+	logger := logging.FromContext(ctx).With("category", category.Slug)
 	if page != nil {
-		requestURL = fmt.Sprintf("%s?page=%d", urlStr, *page)
+		requestURL = fmt.Sprintf("%s?page=%d", category.URL, *page)
+		logger = logger.With("page", *page)
 	}
 
-	fmt.Printf("getting products from: %s\n", requestURL)
+	logger.Debug("getting products", "url", requestURL)
 
 	doc, err := a.getHTML(ctx, requestURL)
 	if err != nil {
-		log.Printf("error getting products from %s: %v", requestURL, err)
+		fail(ctx, logger, "error fetching products", err)
+		return
 	}
 	catalog := findNodeByClass(doc, "div", "catalog-list")
 	if catalog == nil {
-		log.Printf("catalog not found in %s", requestURL)
+		fail(ctx, logger, "error parsing products", fmt.Errorf("catalog not found in %s", requestURL))
+		return
 	}
 
 	catalogItems := findAllNodesByClass(catalog, "article", "catalog-item")
 
-	pageTitle := findNodeByClass(doc, "h1", "page-title")
-	categoryName := getTextContent(pageTitle)
-
 	for _, item := range catalogItems {
 		wg.Add(1)
 		go func() {
@@ -279,20 +328,47 @@ func (a *AtbScraper) fetchProducts(ctx context.Context, urlStr string, page *int
 			name := getTextContent(titleDiv)
 
 			priceValue := findAttrValue(item, "data", "product-price__top", "value")
+			price, err := strconv.ParseFloat(strings.ReplaceAll(priceValue, ",", "."), 64)
+			if err != nil {
+				fail(ctx, logger.With("product", name), "error parsing price", fmt.Errorf("price %q: %w", priceValue, err))
+				return
+			}
+			// Products on sale show the regular price crossed out below the
+			// current one.
+			var oldPrice float64
+			if oldValue := findAttrValue(item, "data", "product-price__bottom", "value"); oldValue != "" {
+				oldPrice, _ = strconv.ParseFloat(strings.ReplaceAll(oldValue, ",", "."), 64)
+			}
+			regular, promo := promoPrices(price, oldPrice)
 			currencyAbbr := findNodeByClass(item, "abbr", "product-price__currency-abbr")
-			currency := getTextContent(currencyAbbr)
-			price := priceValue + " " + currency
+			_, unit, _ := strings.Cut(getTextContent(currencyAbbr), "/")
 
 			href := findHref(titleDiv)
-			ref := atbBaseUrl + href
-
-			resultChan <- []string{
-				strings.ReplaceAll(name, ",", "."),
-				ref,
-				price,
-				categoryName,
-				"ATB",
+			if href == "" {
+				logger.Warn("skipping product without link", "product", name)
+				return
+			}
+			image := findAttrValue(item, "img", "catalog-item__img", "src")
+			if strings.HasPrefix(image, "/") {
+				image = a.BaseURL + image
+			}
+
+			p := models.Product{
+				Name:         name,
+				ExternalID:   path.Base(href),
+				URL:          a.BaseURL + href,
+				ImageURL:     image,
+				Price:        price,
+				RegularPrice: regular,
+				PromoPrice:   promo,
+				Currency:     "UAH",
+				Unit:         unit,
+				CategoryPath: category.path(),
+				StoreCode:    a.Code(),
+				ScrapedAt:    time.Now(),
 			}
+			setQuantity(&p, unit)
+			resultChan <- p
 		}()
 	}
 	wg.Wait()
@@ -301,7 +377,7 @@ func (a *AtbScraper) fetchProducts(ctx context.Context, urlStr string, page *int
 	if err != nil {
 		return
 	}
-	a.fetchProducts(ctx, urlStr, nextPage, resultChan)
+	a.fetchProducts(ctx, category, nextPage, resultChan)
 }
 
 func (a *AtbScraper) getNextPage(doc *html.Node) (*int, error) {
@@ -0,0 +1,35 @@
+package scrapers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/metrics"
+)
+
+// FailureRecorder is told about everything a scraper gave up on: pages of
+// products that could not be fetched, after retries, or parsed, and products
+// that could not be parsed.
+type FailureRecorder interface {
+	RecordFailure(err error)
+}
+
+type failureRecorderKey struct{}
+
+// WithFailureRecorder returns a context whose scrapers report their failures
+// to rec. Scrapers carry on past a failed page, so this is how the runner
+// learns that a store's products are incomplete.
+func WithFailureRecorder(ctx context.Context, rec FailureRecorder) context.Context {
+	return context.WithValue(ctx, failureRecorderKey{}, rec)
+}
+
+// fail logs err as msg, counts it in metrics.PagesFailed and reports it to
+// the FailureRecorder of ctx.
+func fail(ctx context.Context, logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	metrics.PagesFailed.WithLabelValues(metrics.Store(ctx)).Inc()
+	if rec, ok := ctx.Value(failureRecorderKey{}).(FailureRecorder); ok {
+		rec.RecordFailure(fmt.Errorf("%s: %w", msg, err))
+	}
+}
@@ -0,0 +1,255 @@
+package scrapers
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/models"
+)
+
+// Category is a store category as returned by Scraper.GetCategories. Only the
+// fields a store needs to list the category's products are filled in. Stores
+// that price per branch return every category once per scraped branch.
+//
+// Scrapers return the leaves of the store's category tree. Slug is the
+// store's stable id for the category and Path lists its ancestors from the
+// root down, followed by the category itself. BranchName is the store's name
+// for Branch, when it has one.
+type Category struct {
+	Slug       string
+	Name       string
+	URL        string
+	Total      int
+	IDs        []int
+	Branch     string
+	BranchName string
+	Region     string
+	Path       []models.CategoryRef
+}
+
+// ref returns the category as a models.CategoryRef.
+func (c Category) ref() models.CategoryRef {
+	return models.CategoryRef{Ref: c.Slug, Name: c.Name}
+}
+
+// path returns c.Path, or the category alone for stores without a tree.
+func (c Category) path() []models.CategoryRef {
+	if len(c.Path) == 0 {
+		return []models.CategoryRef{c.ref()}
+	}
+	return c.Path
+}
+
+// Scraper is implemented by every store scraper. Code must match stores.code
+// in the database. GetProducts sends the products of cts to out as they are
+// scraped and returns once all of them are sent; it does not close out.
+type Scraper interface {
+	Name() string
+	Code() string
+	GetCategories(ctx context.Context) ([]Category, error)
+	GetProducts(ctx context.Context, cts []Category, out chan<- models.Product) error
+}
+
+// CollectProducts runs s.GetProducts and returns all the products it sends.
+func CollectProducts(ctx context.Context, s Scraper, cts []Category) ([]models.Product, error) {
+	out := make(chan models.Product)
+	done := make(chan struct{})
+	var products []models.Product
+	go func() {
+		defer close(done)
+		for p := range out {
+			products = append(products, p)
+		}
+	}()
+	err := s.GetProducts(ctx, cts, out)
+	close(out)
+	<-done
+	return products, err
+}
+
+// Options are passed to every scraper constructor. Transport, when set,
+// replaces the network transport of the scraper's HTTP client. BaseURLs maps
+// store codes to the scheme and host to scrape instead of the real store API,
+// e.g. a local cmd/fakestores instance; the "*" key applies to every store
+// without an entry of its own. Branches maps store codes to the
+// branches to scrape, given as branch ids or city names; stores fall back to
+// their default branch when none are configured.
+type Options struct {
+	Transport http.RoundTripper
+	BaseURLs  map[string]string
+	Branches  map[string][]string
+}
+
+func (o Options) baseURL(code, def string) string {
+	if u, ok := o.BaseURLs[code]; ok && u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	if u, ok := o.BaseURLs["*"]; ok && u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return def
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]func(Options) (Scraper, error){}
+)
+
+// Register makes a store scraper available to the runner. It is meant to be
+// called from the init function of the file implementing the store. factory
+// fails when Options configure the store in a way it cannot be scraped.
+func Register(code string, factory func(Options) (Scraper, error)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[code]; ok {
+		panic(fmt.Sprintf("scrapers: store %q registered twice", code))
+	}
+	registry[code] = factory
+}
+
+// Codes returns the codes of all registered stores in sorted order.
+func Codes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	codes := make([]string, 0, len(registry))
+	for code := range registry {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// New creates the scraper registered under code.
+func New(code string, opts Options) (Scraper, error) {
+	registryMu.RLock()
+	factory, ok := registry[code]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown store %q", code)
+	}
+	return factory(opts)
+}
+
+// All creates one scraper per registered store.
+func All(opts Options) ([]Scraper, error) {
+	var result []Scraper
+	for _, code := range Codes() {
+		s, err := New(code, opts)
+		if err != nil {
+			return nil, fmt.Errorf("store %s: %w", code, err)
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// promoPrices splits the price a store currently charges and the crossed-out
+// price it shows next to it into a regular and a promo price. A missing or
+// lower old price means the product is not on sale.
+func promoPrices(current, old float64) (regular, promo float64) {
+	if old > current && current > 0 {
+		return old, current
+	}
+	return current, 0
+}
+
+// kyiv is the time zone of promotion end dates given without an offset.
+var kyiv = func() *time.Location {
+	loc, err := time.LoadLocation("Europe/Kyiv")
+	if err != nil {
+		return time.FixedZone("EET", 2*60*60)
+	}
+	return loc
+}()
+
+// parsePromoEnd parses the end of a promotion as returned by the stores. A
+// bare date means the promotion lasts until the end of that day. Empty or
+// unparsable values yield the zero time.
+func parsePromoEnd(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	if t, err := time.ParseInLocation(time.DateTime, s, kyiv); err == nil {
+		return t
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, kyiv); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	if t, err := time.ParseInLocation("02.01.2006", s, kyiv); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return time.Time{}
+}
+
+// descriptionLength caps the product descriptions we keep, in runes.
+const descriptionLength = 300
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// shortDescription turns a store's HTML product description into plain text
+// of at most descriptionLength runes, cut at a word boundary.
+func shortDescription(s string) string {
+	s = html.UnescapeString(htmlTag.ReplaceAllString(s, " "))
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= descriptionLength {
+		return s
+	}
+	cut := string(runes[:descriptionLength])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// setQuantity fills in the package size and unit price of p. Products sold
+// by weight or volume, as told by the store's sale unit, are priced per
+// kilogram or litre. Others take the first quantity found in hints, the
+// store's package size fields, or else in the product name, and fall back to
+// per piece pricing when unit says so.
+func setQuantity(p *models.Product, unit string, hints ...string) {
+	perUnit, ok := models.PerUnit(unit)
+	if ok && perUnit.Unit != models.UnitPiece {
+		p.SetQuantity(perUnit)
+		return
+	}
+	for _, h := range append(hints, p.Name) {
+		if q, found := models.ParseQuantity(h); found {
+			p.SetQuantity(q)
+			return
+		}
+	}
+	if ok {
+		p.SetQuantity(perUnit)
+	}
+}
+
+// walkCategoryTree calls leaf for every leaf of the category tree rooted at
+// nodes, with the path from the root down to the leaf. node returns the
+// category a tree node stands for and its children.
+func walkCategoryTree[T any](nodes []T, node func(T) (models.CategoryRef, []T), leaf func(T, []models.CategoryRef)) {
+	var walk func(nodes []T, parents []models.CategoryRef)
+	walk = func(nodes []T, parents []models.CategoryRef) {
+		for _, n := range nodes {
+			ref, children := node(n)
+			path := append(slices.Clip(parents), ref)
+			if len(children) > 0 {
+				walk(children, path)
+				continue
+			}
+			leaf(n, path)
+		}
+	}
+	walk(nodes, nil)
+}
@@ -0,0 +1,151 @@
+package scrapers_test
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/httpclient"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/scrapers"
+)
+
+// Re-record the fixtures after changing a scraper's requests with
+//
+//	go run ./cmd/fakestores -products 3 &
+//	go test ./internal/scrapers -record localhost:8090
+var record = flag.String("record", "", "record the fixtures in testdata from the cmd/fakestores instance at this address")
+
+// fixtureHost stands in for the fake stores in recorded requests, so that the
+// fixtures do not depend on the address fakestores was recorded from.
+const fixtureHost = "fakestores.test"
+
+// toFakestores sends requests for fixtureHost to the fakestores instance at
+// addr.
+type toFakestores string
+
+func (addr toFakestores) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Host = string(addr)
+	req.Host = fixtureHost
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// failures collects the failures scrapers report.
+type failures struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (f *failures) RecordFailure(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs = append(f.errs, err)
+}
+
+func TestScrapers(t *testing.T) {
+	recorder := &httpclient.Recorder{Dir: "testdata", Mode: httpclient.ModeReplay}
+	if *record != "" {
+		if err := os.RemoveAll(filepath.Join("testdata", fixtureHost)); err != nil {
+			t.Fatal(err)
+		}
+		recorder.Mode = httpclient.ModeRecord
+		recorder.Base = toFakestores(*record)
+	}
+	httpclient.SetRateLimit(fixtureHost, httpclient.RateLimit{})
+	opts := scrapers.Options{
+		Transport: recorder,
+		BaseURLs:  map[string]string{"*": "http://" + fixtureHost},
+	}
+
+	tests := []struct {
+		store          string
+		wantCategories int
+		wantProducts   int
+	}{
+		{store: "atb", wantCategories: 5, wantProducts: 15},
+		{store: "metro", wantCategories: 5, wantProducts: 15},
+		{store: "silpo", wantCategories: 5, wantProducts: 15},
+		{store: "varus", wantCategories: 5, wantProducts: 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.store, func(t *testing.T) {
+			s, err := scrapers.New(tt.store, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fails failures
+			ctx := scrapers.WithFailureRecorder(context.Background(), &fails)
+
+			cts, err := s.GetCategories(ctx)
+			if err != nil {
+				t.Fatalf("GetCategories() error = %v", err)
+			}
+			if len(cts) != tt.wantCategories {
+				t.Errorf("GetCategories() = %d categories, want %d", len(cts), tt.wantCategories)
+			}
+
+			products, err := scrapers.CollectProducts(ctx, s, cts)
+			if err != nil {
+				t.Fatalf("GetProducts() error = %v", err)
+			}
+			if len(products) != tt.wantProducts {
+				t.Errorf("GetProducts() = %d products, want %d", len(products), tt.wantProducts)
+			}
+			for _, err := range fails.errs {
+				t.Errorf("recorded failure: %v", err)
+			}
+			for _, p := range products {
+				if p.Name == "" || p.ExternalID == "" || p.URL == "" || p.Price <= 0 || p.Currency == "" {
+					t.Errorf("incomplete product %+v", p)
+				}
+				if p.StoreCode != tt.store {
+					t.Errorf("product %s of store %q, want %q", p.ExternalID, p.StoreCode, tt.store)
+				}
+				if p.Category().Ref == "" {
+					t.Errorf("product %s has no category", p.ExternalID)
+				}
+			}
+		})
+	}
+}
+
+func TestVarusShops(t *testing.T) {
+	tests := []struct {
+		branches []string
+		want     []scrapers.VarusShop
+		wantErr  bool
+	}{
+		{branches: nil, want: []scrapers.VarusShop{{ID: "3", Region: "Дніпро"}}},
+		{branches: []string{"3"}, want: []scrapers.VarusShop{{ID: "3", Region: "Дніпро"}}},
+		{branches: []string{"дніпро"}, want: []scrapers.VarusShop{{ID: "3", Region: "Дніпро"}}},
+		{branches: []string{"3", "17=Київ"}, want: []scrapers.VarusShop{{ID: "3", Region: "Дніпро"}, {ID: "17", Region: "Київ"}}},
+		{branches: []string{"Житомир"}, wantErr: true},
+		{branches: []string{"999"}, wantErr: true},
+		{branches: []string{"kyiv=Київ"}, wantErr: true},
+		{branches: []string{"017=Київ"}, wantErr: true},
+		{branches: []string{"17="}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.branches, ","), func(t *testing.T) {
+			s, err := scrapers.New("varus", scrapers.Options{Branches: map[string][]string{"varus": tt.branches}})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("New() with branches %q = %+v, want an error", tt.branches, s.(*scrapers.VarusScraper).Shops)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() with branches %q error = %v", tt.branches, err)
+			}
+			if got := s.(*scrapers.VarusScraper).Shops; !slices.Equal(got, tt.want) {
+				t.Errorf("shops = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
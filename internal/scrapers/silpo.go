@@ -5,33 +5,61 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/httpclient"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/logging"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/models"
 	"github.com/MrPuls/groceries-price-aggregator-go/internal/utils"
 )
 
 const (
-	silpoCategoriesURL      = "https://sf-ecom-api.silpo.ua/v1/branches/00000000-0000-0000-0000-000000000000/categories/tree"
-	silpoCategoryDetailsURL = "https://sf-ecom-api.silpo.ua/v1/uk/branches/00000000-0000-0000-0000-000000000000/categories"
-	silpoProductsURL        = "https://sf-ecom-api.silpo.ua/v1/uk/branches/00000000-0000-0000-0000-000000000000/products"
-	silpoProductsQuerySize  = 100
-	silpoSemaphoreSize      = 35
+	silpoBaseURL             = "https://sf-ecom-api.silpo.ua"
+	silpoDefaultBranch       = "00000000-0000-0000-0000-000000000000"
+	silpoBranchesPath        = "/v1/uk/branches"
+	silpoCategoriesPath      = "/v1/branches/%s/categories/tree"
+	silpoCategoryDetailsPath = "/v1/uk/branches/%s/categories"
+	silpoCategoryDepth       = 5
+	silpoProductsPath        = "/v1/uk/branches/%s/products"
+	silpoImageURL            = "https://images.silpo.ua/products/300x300/webp/%s"
+	silpoProductsQuerySize   = 100
+	silpoSemaphoreSize       = 35
+)
+
+var (
+	silpoRetryPolicy = httpclient.RetryPolicy{MaxAttempts: 4, BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+	silpoRateLimit   = httpclient.RateLimit{RequestsPerSecond: 10, Burst: 20}
+	silpoConcurrency = httpclient.Concurrency{Min: 2, Initial: 8, Max: silpoSemaphoreSize}
 )
 
 type SilpoScraper struct {
-	Client  *http.Client
-	Headers map[string]string
+	Client   *httpclient.Client
+	Headers  map[string]string
+	BaseURL  string
+	Branches []string
+}
+
+type SilpoBranch struct {
+	ID   string `json:"id"`
+	Name string `json:"title"`
+	City string `json:"city"`
+}
+
+type SilpoBranches struct {
+	Total int           `json:"total"`
+	Items []SilpoBranch `json:"items"`
 }
 
 type SilpoCategoryItem struct {
 	CategoryName string
-	Slug         string `json:"slug"`
-	Total        int    `json:"total"`
+	Slug         string              `json:"slug"`
+	Total        int                 `json:"total"`
+	Children     []SilpoCategoryItem `json:"children"`
 }
 
 type SilpoCategories struct {
@@ -39,11 +67,36 @@ type SilpoCategories struct {
 	Items []SilpoCategoryItem `json:"items"`
 }
 
+// SilpoProduct.DisplayOldPrice is the crossed-out price of products on sale
+// and null otherwise. Stock is the quantity left in the branch. Icon is the
+// file name of the product picture.
 type SilpoProduct struct {
-	Name         string  `json:"title"`
-	Slug         string  `json:"slug"`
-	DisplayPrice float64 `json:"displayPrice"`
-	DisplayRatio string  `json:"displayRatio"`
+	Name            string   `json:"title"`
+	Slug            string   `json:"slug"`
+	ExternalID      string   `json:"externalProductId"`
+	Brand           string   `json:"brandTitle"`
+	Barcode         string   `json:"barcode"`
+	Icon            string   `json:"icon"`
+	DisplayPrice    float64  `json:"displayPrice"`
+	DisplayOldPrice float64  `json:"displayOldPrice"`
+	DisplayRatio    string   `json:"displayRatio"`
+	Stock           *float64 `json:"stock"`
+}
+
+func (p SilpoProduct) imageURL() string {
+	if p.Icon == "" {
+		return ""
+	}
+	return fmt.Sprintf(silpoImageURL, p.Icon)
+}
+
+// inStock derives availability from the branch stock, nil when unknown.
+func (p SilpoProduct) inStock() *bool {
+	if p.Stock == nil {
+		return nil
+	}
+	available := *p.Stock > 0
+	return &available
 }
 
 type SilpoProducts struct {
@@ -51,19 +104,19 @@ type SilpoProducts struct {
 	Items []SilpoProduct `json:"items"`
 }
 
-func NewSilpoScraper() *SilpoScraper {
+func init() {
+	Register("silpo", func(opts Options) (Scraper, error) { return NewSilpoScraper(opts), nil })
+}
+
+func NewSilpoScraper(opts Options) *SilpoScraper {
 	return &SilpoScraper{
-		Client: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				MaxConnsPerHost:     75,
-				IdleConnTimeout:     90 * time.Second,
-				TLSHandshakeTimeout: 10 * time.Second,
-				DisableKeepAlives:   false,
-			},
-		},
+		Client: httpclient.New(httpclient.Options{
+			Transport:   opts.Transport,
+			Timeout:     30 * time.Second,
+			Retry:       silpoRetryPolicy,
+			RateLimit:   silpoRateLimit,
+			Concurrency: silpoConcurrency,
+		}),
 		Headers: map[string]string{
 			"Accept":          "application/json",
 			"Accept-Encoding": "utf-8",
@@ -78,16 +131,92 @@ func NewSilpoScraper() *SilpoScraper {
 			"TE":              "trailers",
 			"Accept-Language": "en-GB,en;q=0.5",
 		},
+		BaseURL:  opts.baseURL("silpo", silpoBaseURL),
+		Branches: opts.Branches["silpo"],
+	}
+}
+
+func (s *SilpoScraper) Name() string { return "Silpo" }
+
+func (s *SilpoScraper) Code() string { return "silpo" }
+
+// GetCategories returns the category tree of every configured branch.
+func (s *SilpoScraper) GetCategories(ctx context.Context) ([]Category, error) {
+	branches, err := s.getBranches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var categories []Category
+	for _, b := range branches {
+		cts, err := s.getBranchCategories(ctx, b)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, cts...)
+	}
+	return categories, nil
+}
+
+// getBranches resolves s.Branches, matched against branch ids and cities, to
+// the list of branches to scrape. A city stands for its first listed branch:
+// branches in one city share prices closely enough that scraping the whole
+// catalogue once per branch is not worth it. Without configured branches only
+// the default branch is scraped.
+func (s *SilpoScraper) getBranches(ctx context.Context) ([]SilpoBranch, error) {
+	if len(s.Branches) == 0 {
+		return []SilpoBranch{{ID: silpoDefaultBranch}}, nil
+	}
+	p := utils.PrepareURLParams(map[string]string{"deliveryType": "DeliveryHome"})
+	req, err := utils.MakeGetRequest(ctx, s.BaseURL+silpoBranchesPath, s.Headers, p)
+	if err != nil {
+		return nil, fmt.Errorf("[Silpo] error making GET Request: %v", err)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("[Silpo] error getting response from Silpo: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("[Silpo] getting branches: status code %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("[Silpo] error reading response from Silpo: %v", err)
 	}
+	var b SilpoBranches
+	if jsonErr := json.Unmarshal(body, &b); jsonErr != nil {
+		return nil, fmt.Errorf("[Silpo] error unmarshalling response from Silpo: %v", jsonErr)
+	}
+
+	var selected []SilpoBranch
+	for _, wanted := range s.Branches {
+		i := slices.IndexFunc(b.Items, func(branch SilpoBranch) bool { return branch.ID == wanted })
+		if i < 0 {
+			i = slices.IndexFunc(b.Items, func(branch SilpoBranch) bool { return strings.EqualFold(branch.City, wanted) })
+		}
+		if i < 0 {
+			logging.FromContext(ctx).Warn("no branch matches", "branch", wanted)
+			continue
+		}
+		if !slices.Contains(selected, b.Items[i]) {
+			selected = append(selected, b.Items[i])
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("[Silpo] none of the branches %v found among %d branches", s.Branches, len(b.Items))
+	}
+	logging.FromContext(ctx).Info("scraping branches", "branches", len(selected))
+	return selected, nil
 }
 
-func (s *SilpoScraper) GetCategories(ctx context.Context) (*SilpoCategories, error) {
+func (s *SilpoScraper) getBranchCategories(ctx context.Context, branch SilpoBranch) ([]Category, error) {
 	params := map[string]string{
 		"deliveryType": "DeliveryHome",
-		"depth":        "1",
+		"depth":        strconv.Itoa(silpoCategoryDepth),
 	}
 	reqParams := utils.PrepareURLParams(params)
-	req, err := utils.MakeGetRequest(ctx, silpoCategoriesURL, s.Headers, reqParams)
+	reqURL := s.BaseURL + fmt.Sprintf(silpoCategoriesPath, branch.ID)
+	req, err := utils.MakeGetRequest(ctx, reqURL, s.Headers, reqParams)
 	if err != nil {
 		return nil, fmt.Errorf("[Silpo] error making GET Request: %v", err)
 	}
@@ -103,75 +232,98 @@ func (s *SilpoScraper) GetCategories(ctx context.Context) (*SilpoCategories, err
 	if err != nil {
 		return nil, fmt.Errorf("[Silpo] error reading response from Silpo: %v", err)
 	}
-	var c *SilpoCategories
+	var c SilpoCategories
 	jsonErr := json.Unmarshal(body, &c)
 	if jsonErr != nil {
 		return nil, fmt.Errorf("[Silpo] error unmarshalling response from Silpo: %v", jsonErr)
 	}
-	var total int
-	for _, v := range c.Items {
-		total += v.Total
+	var nodes []*SilpoCategoryItem
+	var collect func(items []SilpoCategoryItem)
+	collect = func(items []SilpoCategoryItem) {
+		for k := range items {
+			nodes = append(nodes, &items[k])
+			collect(items[k].Children)
+		}
 	}
-	titlesErr := s.getCategoriesTitles(ctx, c)
+	collect(c.Items)
+	titlesErr := s.getCategoriesTitles(ctx, branch.ID, nodes)
 	if titlesErr != nil {
 		return nil, fmt.Errorf("[Silpo] error getting categories titles: %v", titlesErr)
 	}
-	fmt.Printf("[Silpo] Found %v categories with total amount of items: %v\n", c.Total, total)
-	return c, nil
+	var categories []Category
+	var total int
+	walkCategoryTree(c.Items,
+		func(v SilpoCategoryItem) (models.CategoryRef, []SilpoCategoryItem) {
+			return models.CategoryRef{Ref: v.Slug, Name: v.CategoryName}, v.Children
+		},
+		func(v SilpoCategoryItem, path []models.CategoryRef) {
+			total += v.Total
+			categories = append(categories, Category{
+				Slug:       v.Slug,
+				Name:       v.CategoryName,
+				Total:      v.Total,
+				Branch:     branch.ID,
+				BranchName: branch.Name,
+				Region:     branch.City,
+				Path:       path,
+			})
+		})
+	logging.FromContext(ctx).Info("found categories", "branch", branch.ID, "categories", len(categories), "products", total)
+	return categories, nil
 }
 
-func (s *SilpoScraper) getCategoriesTitles(ctx context.Context, cts *SilpoCategories) error {
+func (s *SilpoScraper) getCategoriesTitles(ctx context.Context, branch string, cts []*SilpoCategoryItem) error {
 	var wg sync.WaitGroup
-	for k, v := range cts.Items {
+	for _, v := range cts {
 		wg.Add(1)
-		go func(k int, v SilpoCategoryItem) {
+		go func(v *SilpoCategoryItem) {
 			defer wg.Done()
 			select {
 			case <-ctx.Done():
 				return
 			default:
 			}
-			ctUrl := fmt.Sprintf("%s/%s", silpoCategoryDetailsURL, v.Slug)
+			logger := logging.FromContext(ctx).With("branch", branch, "category", v.Slug)
+			ctUrl := fmt.Sprintf("%s%s/%s", s.BaseURL, fmt.Sprintf(silpoCategoryDetailsPath, branch), v.Slug)
 			req, err := utils.MakeGetRequest(ctx, ctUrl, s.Headers, nil)
 			if err != nil {
-				fmt.Printf("[Silpo] error making GET Request: %v", err)
+				fail(ctx, logger, "error making category request", err)
 				return
 			}
 			resp, err := s.Client.Do(req)
 			if err != nil {
-				fmt.Printf("[Silpo] error getting response from Silpo: %v", err)
+				fail(ctx, logger, "error getting category", err)
 				return
 			}
 			defer func() { _ = resp.Body.Close() }()
 			if resp.StatusCode != http.StatusOK {
-				fmt.Printf("[Silpo] getting categories: status code %d", resp.StatusCode)
+				fail(ctx, logger, "error getting category", fmt.Errorf("bad status for %s: %s", req.URL, resp.Status))
 				return
 			}
 			body, err := io.ReadAll(resp.Body)
 			if err != nil {
-				fmt.Printf("[Silpo] error reading response from Silpo: %v", err)
+				fail(ctx, logger, "error reading category", err)
 				return
 			}
 			var ci SilpoCategoryItem
 			jsonErr := json.Unmarshal(body, &ci)
 			if jsonErr != nil {
-				fmt.Printf("[Silpo] error unmarshalling response from Silpo: %v", jsonErr)
+				fail(ctx, logger, "error unmarshalling category", jsonErr)
+				return
 			}
-			cts.Items[k].CategoryName = ci.CategoryName
-		}(k, v)
+			v.CategoryName = ci.CategoryName
+		}(v)
 	}
 	wg.Wait()
 	return nil
 }
 
-func (s *SilpoScraper) GetProducts(ctx context.Context, cti []SilpoCategoryItem) ([][]string, error) {
-	var result [][]string
+func (s *SilpoScraper) GetProducts(ctx context.Context, cti []Category, out chan<- models.Product) error {
 	var wg sync.WaitGroup
 	var httpSemaphore = make(chan struct{}, silpoSemaphoreSize)
-	resultsChan := make(chan []string)
 	for _, ci := range cti {
 		wg.Add(1)
-		go func(ci SilpoCategoryItem) {
+		go func(ci Category) {
 			defer wg.Done()
 			var offsetWg sync.WaitGroup
 			for offset := 0; offset <= ci.Total; offset += silpoProductsQuerySize {
@@ -185,36 +337,56 @@ func (s *SilpoScraper) GetProducts(ctx context.Context, cti []SilpoCategoryItem)
 						return
 					default:
 					}
-					products, err := s.getProductsFromOffset(ctx, ci.Slug, offset)
+					products, err := s.getProductsFromOffset(ctx, ci.Branch, ci.Slug, offset)
 					if err != nil {
-						log.Printf("[Silpo] Error fetching products from offset %d: %v", offset, err)
+						fail(ctx, logging.FromContext(ctx).With("branch", ci.Branch, "category", ci.Slug, "offset", offset), "error fetching products", err)
 						return
 					}
 					for _, v := range products.Items {
-						resultsChan <- []string{
-							fmt.Sprintf("%s, %s", strings.ReplaceAll(v.Name, ",", "."), v.DisplayRatio),
-							fmt.Sprintf("https://silpo.ua/product/%s", v.Slug),
-							fmt.Sprintf("%.2f грн", v.DisplayPrice),
-							ci.CategoryName,
-							"silpo",
+						// The slug changes when a product is renamed, the
+						// external id does not.
+						if v.ExternalID == "" {
+							logging.FromContext(ctx).Warn("skipping product without external id", "branch", ci.Branch, "category", ci.Slug, "product", v.Name)
+							continue
+						}
+						regular, promo := promoPrices(v.DisplayPrice, v.DisplayOldPrice)
+						p := models.Product{
+							Name:         v.Name,
+							ExternalID:   v.ExternalID,
+							URL:          fmt.Sprintf("https://silpo.ua/product/%s", v.Slug),
+							Brand:        v.Brand,
+							SKU:          v.ExternalID,
+							EAN:          v.Barcode,
+							ImageURL:     v.imageURL(),
+							Price:        v.DisplayPrice,
+							RegularPrice: regular,
+							PromoPrice:   promo,
+							Currency:     "UAH",
+							Unit:         v.DisplayRatio,
+							InStock:      v.inStock(),
+							StockQty:     v.Stock,
+							CategoryPath: ci.path(),
+							StoreCode:    s.Code(),
+							Branch:       ci.Branch,
+							BranchName:   ci.BranchName,
+							Region:       ci.Region,
+							ScrapedAt:    time.Now(),
 						}
+						setQuantity(&p, "", v.DisplayRatio)
+						out <- p
 					}
 				}(offset)
 			}
 			offsetWg.Wait()
 		}(ci)
 	}
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
-	for product := range resultsChan {
-		result = append(result, product)
-	}
-	return result, nil
+	wg.Wait()
+	return nil
 }
 
-func (s *SilpoScraper) getProductsFromOffset(ctx context.Context, slug string, offset int) (*SilpoProducts, error) {
+func (s *SilpoScraper) getProductsFromOffset(ctx context.Context, branch, slug string, offset int) (*SilpoProducts, error) {
+	// inStock=false lists sold out products too; their stock is recorded so
+	// they can be told apart.
 	p := utils.PrepareURLParams(map[string]string{
 		"deliveryType":           "DeliveryHome",
 		"category":               slug,
@@ -225,11 +397,11 @@ func (s *SilpoScraper) getProductsFromOffset(ctx context.Context, slug string, o
 		"limit":                  strconv.Itoa(silpoProductsQuerySize),
 		"offset":                 strconv.Itoa(offset),
 	})
-	req, err := utils.MakeGetRequest(ctx, silpoProductsURL, s.Headers, p)
+	req, err := utils.MakeGetRequest(ctx, s.BaseURL+fmt.Sprintf(silpoProductsPath, branch), s.Headers, p)
 	if err != nil {
 		return nil, fmt.Errorf("[Silpo] error making GET Request: %v", err)
 	}
-	fmt.Printf("[Silpo] Getting products from: %s\n", req.URL)
+	logging.FromContext(ctx).Debug("getting products", "branch", branch, "category", slug, "offset", offset, "url", req.URL.String())
 	resp, err := s.Client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("[Silpo] error getting response from Silpo: %v", err)
@@ -1,6 +1,7 @@
 package scrapers
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,21 +9,38 @@ import (
 	"maps"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/httpclient"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/logging"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/models"
 	"github.com/MrPuls/groceries-price-aggregator-go/internal/utils"
 )
 
 const (
-	varusCategoriesURL = "https://varus.ua/api/catalog/vue_storefront_catalog_2/banner/_search"
-	varusProductsURL   = "https://varus.ua/api/catalog/vue_storefront_catalog_2/product_v2/_search"
-	varusQuerySize     = 100
-	varusSemaphoreSize = 35
+	varusBaseURL        = "https://varus.ua"
+	varusCategoriesPath = "/api/catalog/vue_storefront_catalog_2/category/_search"
+	varusProductsPath   = "/api/catalog/vue_storefront_catalog_2/product_v2/_search"
+	varusQuerySize      = 100
+	varusCategoriesSize = 1000
+	varusSemaphoreSize  = 35
+	varusDefaultShop    = "3"
+	varusImageURL       = "https://images.varus.ua/c1130x1130/product"
 )
 
+// varusShopRegions names the region of the shops whose prices we know how to
+// label. Shops outside this table can still be scraped with an "id=region"
+// branch entry. A region's first shop, by id, is scraped when the region is
+// configured by name.
+var varusShopRegions = map[string]string{
+	"3": "Дніпро",
+}
+
 var requestParams = map[string]string{
 	"_source_exclude": "",
 	"_source_include": "brand_data.name,description,category,category_ids,stock.is_in_stock,forNewPost,stock.qty," +
@@ -35,28 +53,48 @@ var requestParams = map[string]string{
 	"from":            "",
 	"request_format":  "search-query",
 	"response_format": "compact",
-	"shop_id":         "3",
+	"shop_id":         "",
 	"size":            "",
 	"sort":            "",
 }
 
+var (
+	varusRetryPolicy = httpclient.RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+	varusRateLimit   = httpclient.RateLimit{RequestsPerSecond: 8, Burst: 16}
+	varusConcurrency = httpclient.Concurrency{Min: 2, Initial: 8, Max: varusSemaphoreSize}
+)
+
 type VarusScraper struct {
-	Client  *http.Client
+	Client  *httpclient.Client
 	Headers map[string]string
+	BaseURL string
+	Shops   []VarusShop
+}
+
+// VarusShop is a shop whose prices are scraped; Varus prices per region.
+type VarusShop struct {
+	ID     string
+	Region string
 }
 
+// VarusCategoryItem is a node of the category tree, linked to its parent by
+// ParentID.
 type VarusCategoryItem struct {
-	Slug        string `json:"link"`
-	CategoryIds []int  `json:"category_ids"`
-	Total       int
+	ID       int    `json:"id"`
+	ParentID int    `json:"parent_id"`
+	Name     string `json:"name"`
+	URLPath  string `json:"url_path"`
 }
 
+// VarusCategories is a page of categories; Total counts all of them.
 type VarusCategories struct {
-	Items []VarusCategoryItem `json:"hits"`
+	Items []VarusCategoryItem      `json:"hits"`
+	Total VarusProductTotalDetails `json:"total"`
 }
 
 type VarusProductPriceDetails struct {
-	Price float64 `json:"price"`
+	Price   float64 `json:"price"`
+	InStock *bool   `json:"in_stock"`
 }
 
 type VarusProductTotalDetails struct {
@@ -67,29 +105,218 @@ type VarusProductsTotal struct {
 	Total VarusProductTotalDetails `json:"total"`
 }
 
+// varusNumber accepts numbers sent either as JSON numbers or as strings, as
+// the promo fields come in both forms, and flags sent as booleans. Anything
+// else reads as zero.
+type varusNumber float64
+
+func (n *varusNumber) UnmarshalJSON(data []byte) error {
+	if string(data) == "true" {
+		*n = 1
+		return nil
+	}
+	f, err := strconv.ParseFloat(strings.Trim(string(data), `"`), 64)
+	if err != nil {
+		*n = 0
+		return nil
+	}
+	*n = varusNumber(f)
+	return nil
+}
+
+type VarusBrand struct {
+	Name string `json:"name"`
+}
+
 type VarusProduct struct {
-	Name  string                   `json:"name"`
-	Ref   string                   `json:"url_key"`
-	Price VarusProductPriceDetails `json:"sqpp_data_region_default"`
+	Name                 string                   `json:"name"`
+	Sku                  string                   `json:"sku"`
+	Ref                  string                   `json:"url_key"`
+	Brand                VarusBrand               `json:"brand_data"`
+	Image                string                   `json:"image"`
+	Description          string                   `json:"description"`
+	Price                VarusProductPriceDetails `json:"sqpp_data_region_default"`
+	RegularPrice         varusNumber              `json:"regular_price"`
+	SpecialPriceDiscount varusNumber              `json:"special_price_discount"`
+	SpecialPriceToDate   string                   `json:"special_price_to_date"`
+	Volume               varusNumber              `json:"volume"`
+	Weight               varusNumber              `json:"weight"`
+	Weighed              varusNumber              `json:"wghweigh"`
+	QuantityUnit         string                   `json:"productquantityunit"`
+	// ShopPrices holds the sqpp_data_<shop id> objects, keyed by shop id.
+	ShopPrices map[string]VarusProductPriceDetails `json:"-"`
+}
+
+func (p *VarusProduct) UnmarshalJSON(data []byte) error {
+	type plain VarusProduct
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for k, v := range raw {
+		shop, ok := strings.CutPrefix(k, "sqpp_data_")
+		if !ok || shop == "region_default" {
+			continue
+		}
+		var d VarusProductPriceDetails
+		if err := json.Unmarshal(v, &d); err != nil {
+			continue
+		}
+		if p.ShopPrices == nil {
+			p.ShopPrices = make(map[string]VarusProductPriceDetails)
+		}
+		p.ShopPrices[shop] = d
+	}
+	return nil
+}
+
+// priceFor returns the price in shop, falling back to the region default.
+func (p VarusProduct) priceFor(shop string) float64 {
+	if d, ok := p.ShopPrices[shop]; ok && d.Price > 0 {
+		return d.Price
+	}
+	return p.Price.Price
+}
+
+// inStock returns whether p can be bought in shop, nil when Varus does not
+// say. The stock quantity Varus returns is that of its warehouse rather than
+// of the shop, so it is not recorded.
+func (p VarusProduct) inStock(shop string) *bool {
+	if d, ok := p.ShopPrices[shop]; ok {
+		return d.InStock
+	}
+	return nil
+}
+
+// imageURL resolves the image path Varus returns against its image host.
+func (p VarusProduct) imageURL() string {
+	if p.Image == "" || strings.HasPrefix(p.Image, "http") {
+		return p.Image
+	}
+	return varusImageURL + "/" + strings.TrimPrefix(p.Image, "/")
+}
+
+// setQuantity fills in the package size of product. Volume and weight are
+// in litres and kilograms and only used when the name has no package size.
+func (p VarusProduct) setQuantity(product *models.Product) {
+	unit := p.QuantityUnit
+	if p.Weighed > 0 {
+		unit = models.UnitKilogram
+	}
+	var hints []string
+	hints = append(hints, p.Name)
+	if p.Volume > 0 {
+		hints = append(hints, fmt.Sprintf("%gл", float64(p.Volume)))
+	}
+	if p.Weight > 0 {
+		hints = append(hints, fmt.Sprintf("%gкг", float64(p.Weight)))
+	}
+	setQuantity(product, unit, hints...)
+}
+
+// product converts p into the offer of shop.
+func (p VarusProduct) product(shop VarusShop, category Category) models.Product {
+	price := p.priceFor(shop.ID)
+	regular, promo := price, 0.0
+	var promoEndsAt time.Time
+	if p.SpecialPriceDiscount > 0 {
+		regular, promo = promoPrices(price, float64(p.RegularPrice))
+	}
+	if promo > 0 {
+		promoEndsAt = parsePromoEnd(p.SpecialPriceToDate)
+	}
+	product := models.Product{
+		Name:         p.Name,
+		ExternalID:   p.Sku,
+		URL:          fmt.Sprintf("https://varus.ua/%s", p.Ref),
+		Brand:        p.Brand.Name,
+		SKU:          p.Sku,
+		ImageURL:     p.imageURL(),
+		Description:  shortDescription(p.Description),
+		Price:        price,
+		RegularPrice: regular,
+		PromoPrice:   promo,
+		PromoEndsAt:  promoEndsAt,
+		Currency:     "UAH",
+		Unit:         p.QuantityUnit,
+		InStock:      p.inStock(shop.ID),
+		CategoryPath: category.path(),
+		StoreCode:    "varus",
+		Branch:       shop.ID,
+		Region:       shop.Region,
+		ScrapedAt:    time.Now(),
+	}
+	p.setQuantity(&product)
+	return product
 }
 
 type VarusProducts struct {
 	Items []VarusProduct `json:"hits"`
 }
 
-func NewVarusScraper() *VarusScraper {
+func init() {
+	Register("varus", func(opts Options) (Scraper, error) { return NewVarusScraper(opts) })
+}
+
+// varusShops turns configured branches into shops. An entry is a shop id from
+// varusShopRegions, a region from it or "id=region". Other entries are
+// rejected, as Varus would fail every request for them.
+func varusShops(branches []string) ([]VarusShop, error) {
+	if len(branches) == 0 {
+		return []VarusShop{{ID: varusDefaultShop, Region: varusShopRegions[varusDefaultShop]}}, nil
+	}
+	ids := slices.SortedFunc(maps.Keys(varusShopRegions), func(a, b string) int {
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return cmp.Compare(x, y)
+	})
+	var shops []VarusShop
+	for _, b := range branches {
+		if id, region, ok := strings.Cut(b, "="); ok {
+			if !validVarusShopID(id) || strings.TrimSpace(region) == "" {
+				return nil, fmt.Errorf("invalid Varus shop %q: expected a numeric shop id and a region", b)
+			}
+			shops = append(shops, VarusShop{ID: id, Region: region})
+			continue
+		}
+		if region, ok := varusShopRegions[b]; ok {
+			shops = append(shops, VarusShop{ID: b, Region: region})
+			continue
+		}
+		i := slices.IndexFunc(ids, func(id string) bool { return strings.EqualFold(varusShopRegions[id], b) })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown Varus shop or region %q: give it as \"id=region\"", b)
+		}
+		shops = append(shops, VarusShop{ID: ids[i], Region: varusShopRegions[ids[i]]})
+	}
+	return shops, nil
+}
+
+// validVarusShopID reports whether id is a shop id as Varus expects it, a
+// positive integer.
+func validVarusShopID(id string) bool {
+	n, err := strconv.Atoi(id)
+	return err == nil && n > 0 && strconv.Itoa(n) == id
+}
+
+// NewVarusScraper returns a scraper of the shops configured in
+// opts.Branches, failing when one of them is invalid.
+func NewVarusScraper(opts Options) (*VarusScraper, error) {
+	shops, err := varusShops(opts.Branches["varus"])
+	if err != nil {
+		return nil, err
+	}
 	return &VarusScraper{
-		Client: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				MaxConnsPerHost:     75,
-				IdleConnTimeout:     90 * time.Second,
-				TLSHandshakeTimeout: 10 * time.Second,
-				DisableKeepAlives:   false,
-			},
-		},
+		Client: httpclient.New(httpclient.Options{
+			Transport:   opts.Transport,
+			Timeout:     30 * time.Second,
+			Retry:       varusRetryPolicy,
+			RateLimit:   varusRateLimit,
+			Concurrency: varusConcurrency,
+		}),
 		Headers: map[string]string{
 			"Host":            "varus.ua",
 			"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:141.0) Gecko/20100101 Firefox/141.0",
@@ -106,66 +333,132 @@ func NewVarusScraper() *VarusScraper {
 			"Priority":        "u=4",
 			"TE":              "trailers",
 		},
+		BaseURL: opts.baseURL("varus", varusBaseURL),
+		Shops:   shops,
+	}, nil
+}
+
+func (v *VarusScraper) Name() string { return "Varus" }
+
+func (v *VarusScraper) Code() string { return "varus" }
+
+func (v *VarusScraper) GetCategories(ctx context.Context) ([]Category, error) {
+	// Categories are paged like products; without a total, a short page is
+	// the last one.
+	var c VarusCategories
+	for {
+		page, err := v.getCategoriesPage(ctx, len(c.Items))
+		if err != nil {
+			return nil, err
+		}
+		c.Items = append(c.Items, page.Items...)
+		if len(page.Items) == 0 ||
+			page.Total.Value > 0 && len(c.Items) >= page.Total.Value ||
+			page.Total.Value == 0 && len(page.Items) < varusCategoriesSize {
+			break
+		}
+	}
+
+	// Categories come as a flat list; the roots are the ones whose parent,
+	// the invisible store root, is not listed.
+	ids := make(map[int]bool, len(c.Items))
+	for _, ci := range c.Items {
+		ids[ci.ID] = true
+	}
+	children := make(map[int][]VarusCategoryItem)
+	var roots []VarusCategoryItem
+	for _, ci := range c.Items {
+		if ids[ci.ParentID] {
+			children[ci.ParentID] = append(children[ci.ParentID], ci)
+		} else {
+			roots = append(roots, ci)
+		}
+	}
+	var leaves []Category
+	walkCategoryTree(roots,
+		func(ci VarusCategoryItem) (models.CategoryRef, []VarusCategoryItem) {
+			return models.CategoryRef{Ref: strconv.Itoa(ci.ID), Name: ci.Name}, children[ci.ID]
+		},
+		func(ci VarusCategoryItem, path []models.CategoryRef) {
+			leaves = append(leaves, Category{
+				Slug: strconv.Itoa(ci.ID),
+				Name: ci.Name,
+				URL:  fmt.Sprintf("https://varus.ua/%s", ci.URLPath),
+				IDs:  []int{ci.ID},
+				Path: path,
+			})
+		})
+
+	categories := make([]Category, 0, len(leaves)*len(v.Shops))
+	for _, shop := range v.Shops {
+		for _, leaf := range leaves {
+			leaf.Branch = shop.ID
+			leaf.Region = shop.Region
+			categories = append(categories, leaf)
+		}
+	}
+	tErr := v.getProductsTotalValues(ctx, categories)
+	if tErr != nil {
+		return nil, fmt.Errorf("[Varus] error getting products total values: %v", tErr)
 	}
+	return categories, nil
 }
 
-func (v *VarusScraper) GetCategories(ctx context.Context) (*VarusCategories, error) {
+// getCategoriesPage returns up to varusCategoriesSize categories, starting
+// at offset from.
+func (v *VarusScraper) getCategoriesPage(ctx context.Context, from int) (VarusCategories, error) {
+	var c VarusCategories
 	requestData := map[string]interface{}{
 		"_availableFilters": []string{},
 		"_appliedFilters": []map[string]interface{}{
-			{"attribute": "datetime_from", "value": map[string]string{"lt": "now"}, "scope": "default"},
-			{"attribute": "datetime_to", "value": map[string]string{"gt": "now-1d"}, "scope": "default"},
-			{"attribute": "status", "value": map[string]string{"eq": "1"}, "scope": "default"},
-			{"attribute": "position", "value": map[string]string{"eq": "3"}, "scope": "default"},
+			{"attribute": "is_active", "value": map[string]bool{"eq": true}, "scope": "default"},
 		},
 		"_appliedSort": []string{},
 		"_searchText":  "",
 	}
 	marshaledData, err := json.Marshal(requestData)
 	if err != nil {
-		return nil, fmt.Errorf("[Varus] error marshalling request data: %v", err)
+		return c, fmt.Errorf("[Varus] error marshalling request data: %v", err)
 	}
 
 	categoriesParams := map[string]string{
-		"_source_exclude": "tms,tsk,sgn,paths,created_time,update_time",
-		"from":            "0",
+		"_source_include": "id,parent_id,name,url_path",
+		"from":            strconv.Itoa(from),
 		"request":         string(marshaledData),
 		"request_format":  "search-query",
 		"response_format": "compact",
-		"size":            "50",
+		"size":            strconv.Itoa(varusCategoriesSize),
 		"sort":            "",
 	}
 
 	p := utils.PrepareURLParams(categoriesParams)
-	req, err := utils.MakeGetRequest(ctx, varusCategoriesURL, v.Headers, p)
+	req, err := utils.MakeGetRequest(ctx, v.BaseURL+varusCategoriesPath, v.Headers, p)
 	if err != nil {
-		return nil, fmt.Errorf("[Varus] error making GET Request: %v", err)
+		return c, fmt.Errorf("[Varus] error making GET Request: %v", err)
 	}
 
 	resp, err := v.Client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("[Varus] error getting response from Varus: %v", err)
+		return c, fmt.Errorf("[Varus] error getting response from Varus: %v", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("[Varus] getting categories: status code %d", resp.StatusCode)
+		return c, fmt.Errorf("[Varus] getting categories: status code %d", resp.StatusCode)
 	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("[Varus] error reading response from Varus: %v", err)
+		return c, fmt.Errorf("[Varus] error reading response from Varus: %v", err)
 	}
-	var c *VarusCategories
-	jsonErr := json.Unmarshal(body, &c)
-	if jsonErr != nil {
-		return nil, fmt.Errorf("[Varus] error unmarshalling response from Varus: %v", jsonErr)
+	if err := json.Unmarshal(body, &c); err != nil {
+		return c, fmt.Errorf("[Varus] error unmarshalling response from Varus: %v", err)
 	}
 	return c, nil
 }
 
-func (v *VarusScraper) GetProductsTotalValues(ctx context.Context, cts *VarusCategories) error {
+func (v *VarusScraper) getProductsTotalValues(ctx context.Context, cts []Category) error {
 	var wg sync.WaitGroup
-	totalProducts := 0
-	for k, ci := range cts.Items {
+	var totalProducts atomic.Int64
+	for k, ci := range cts {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -174,33 +467,34 @@ func (v *VarusScraper) GetProductsTotalValues(ctx context.Context, cts *VarusCat
 				return
 			default:
 			}
-			req, err := v.buildProductsRequest(ctx, ci.CategoryIds, 0)
+			logger := logging.FromContext(ctx).With("branch", ci.Branch, "category", ci.Slug)
+			req, err := v.buildProductsRequest(ctx, ci.Branch, ci.IDs, 0)
 			if err != nil {
-				fmt.Printf("[Varus] error building products request: %v", err)
+				fail(ctx, logger, "error building products request", err)
+				return
 			}
-			productsTotalErr := v.getProductsTotal(req, &cts.Items[k])
+			productsTotalErr := v.getProductsTotal(req, &cts[k])
 			if productsTotalErr != nil {
-				fmt.Printf("[Varus] error getting products total: %v", productsTotalErr)
+				fail(ctx, logger, "error getting products total", productsTotalErr)
+				return
 			}
-			totalProducts += cts.Items[k].Total
+			totalProducts.Add(int64(cts[k].Total))
 		}()
 	}
 	wg.Wait()
-	fmt.Printf("[Varus] Total products: %d\n", totalProducts)
+	logging.FromContext(ctx).Info("found categories", "categories", len(cts), "products", totalProducts.Load())
 	return nil
 }
 
-func (v *VarusScraper) GetProducts(ctx context.Context, cts *VarusCategories) ([][]string, error) {
-	var result [][]string
+func (v *VarusScraper) GetProducts(ctx context.Context, cts []Category, out chan<- models.Product) error {
 	var wg sync.WaitGroup
 	var httpSemaphore = make(chan struct{}, varusSemaphoreSize)
-	resultsChan := make(chan []string)
-	for _, ci := range cts.Items {
+	for _, ci := range cts {
 		wg.Add(1)
-		go func(ci VarusCategoryItem) {
+		go func(ci Category) {
 			defer wg.Done()
 			var offsetWg sync.WaitGroup
-			fmt.Printf("Fetching {%v} products for: %s\n", ci.Total, ci.Slug)
+			logging.FromContext(ctx).Debug("getting products", "branch", ci.Branch, "category", ci.Slug, "products", ci.Total)
 			for offset := 0; offset <= ci.Total; offset += varusQuerySize {
 				offsetWg.Add(1)
 				go func(offset int) {
@@ -212,61 +506,54 @@ func (v *VarusScraper) GetProducts(ctx context.Context, cts *VarusCategories) ([
 						return
 					default:
 					}
-					request, err := v.buildProductsRequest(ctx, ci.CategoryIds, offset)
+					logger := logging.FromContext(ctx).With("branch", ci.Branch, "category", ci.Slug, "offset", offset)
+					request, err := v.buildProductsRequest(ctx, ci.Branch, ci.IDs, offset)
 					if err != nil {
-						fmt.Printf("[Varus] error building products request: %v", err)
+						fail(ctx, logger, "error building products request", err)
+						return
 					}
 					resp, err := v.Client.Do(request)
 					if err != nil {
-						fmt.Printf("[Varus] error getting resp from Varus: %v", err)
+						fail(ctx, logger, "error fetching products", err)
+						return
 					}
 					defer func() { _ = resp.Body.Close() }()
 					if resp.StatusCode != http.StatusOK {
-						fmt.Printf("[Varus] getting categories: status code %d", resp.StatusCode)
+						fail(ctx, logger, "error fetching products", fmt.Errorf("bad status for %s: %s", request.URL, resp.Status))
+						return
 					}
 					body, err := io.ReadAll(resp.Body)
 					if err != nil {
-						fmt.Printf("[Varus] error reading resp from Varus: %v", err)
+						fail(ctx, logger, "error reading products", err)
+						return
 					}
 					var prd VarusProducts
 					jsonErr := json.Unmarshal(body, &prd)
 					if jsonErr != nil {
-						fmt.Printf("[Varus] error unmarshalling resp from Varus: %v", jsonErr)
+						fail(ctx, logger, "error unmarshalling products", jsonErr)
+						return
 					}
+					shop := VarusShop{ID: ci.Branch, Region: ci.Region}
 					for _, i := range prd.Items {
-						resultsChan <- []string{
-							strings.ReplaceAll(i.Name, ",", "."),
-							fmt.Sprintf("https://varus.ua/%s", i.Ref),
-							fmt.Sprintf("%.2f грн", i.Price.Price),
-							ci.Slug,
-							"varus",
-						}
+						out <- i.product(shop, ci)
 					}
 				}(offset)
 			}
 			offsetWg.Wait()
 		}(ci)
 	}
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
-
-	for product := range resultsChan {
-		result = append(result, product)
-	}
-
-	return result, nil
+	wg.Wait()
+	return nil
 }
 
-func (v *VarusScraper) getProductsTotal(req *http.Request, category *VarusCategoryItem) error {
+func (v *VarusScraper) getProductsTotal(req *http.Request, category *Category) error {
 	resp, err := v.Client.Do(req)
 	if err != nil {
 		return fmt.Errorf("[Varus] error getting response from Varus: %v", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("[Varus] getting categories: status code %d", resp.StatusCode)
+		return fmt.Errorf("[Varus] getting products total: status code %d", resp.StatusCode)
 	}
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -274,17 +561,23 @@ func (v *VarusScraper) getProductsTotal(req *http.Request, category *VarusCatego
 	}
 	var cti VarusProductsTotal
 	jsonErr := json.Unmarshal(respBody, &cti)
-	category.Total = cti.Total.Value
 	if jsonErr != nil {
 		return fmt.Errorf("[Varus] error unmarshalling response from Varus: %v", jsonErr)
 	}
+	category.Total = cti.Total.Value
 	return nil
 }
 
-func (v *VarusScraper) buildProductsRequest(ctx context.Context, categories []int, offset int) (*http.Request, error) {
+func (v *VarusScraper) buildProductsRequest(ctx context.Context, shop string, categories []int, offset int) (*http.Request, error) {
+	shopID, err := strconv.Atoi(shop)
+	if err != nil {
+		return nil, fmt.Errorf("[Varus] invalid shop id %q: %v", shop, err)
+	}
 	params := maps.Clone(requestParams)
 	params["from"] = strconv.Itoa(offset)
 	params["size"] = strconv.Itoa(varusQuerySize)
+	params["shop_id"] = shop
+	params["_source_include"] += ",sqpp_data_" + shop
 	urlParams := utils.PrepareURLParams(params)
 
 	requestQuery := map[string]any{
@@ -292,7 +585,7 @@ func (v *VarusScraper) buildProductsRequest(ctx context.Context, categories []in
 			{"field": "pim_brand_id", "scope": "catalog", "options": map[string]any{}},
 			{"field": "countrymanufacturerforsite", "scope": "catalog", "options": map[string]any{}},
 			{"field": "promotion_banner_ids", "scope": "catalog", "options": map[string]any{}},
-			{"field": "price", "scope": "catalog", "options": map[string]any{"shop_id": 3, "version": "2"}},
+			{"field": "price", "scope": "catalog", "options": map[string]any{"shop_id": shopID, "version": "2"}},
 			{"field": "has_promotion_in_stores", "scope": "catalog", "options": map[string]any{"size": 10000}},
 			{"field": "markdown_id", "scope": "catalog", "options": map[string]any{}}},
 		"_appliedFilters": []map[string]any{{"attribute": "visibility",
@@ -301,7 +594,6 @@ func (v *VarusScraper) buildProductsRequest(ctx context.Context, categories []in
 				"scope": "default"}, {"attribute": "category_ids",
 				"value": map[string]any{"in": categories}, "scope": "default"},
 			{"attribute": "markdown_id", "value": map[string]any{"or": nil}, "scope": "default"},
-			{"attribute": "sqpp_data_3.in_stock", "value": map[string]any{"or": true}, "scope": "default"},
 			{"attribute": "markdown_id", "value": map[string]any{"nin": nil}, "scope": "default"}},
 		"_appliedSort": []map[string]any{
 			{"field": "_script",
@@ -338,7 +630,7 @@ func (v *VarusScraper) buildProductsRequest(ctx context.Context, categories []in
 		return nil, fmt.Errorf("[Varus] error marshalling request data: %v", err)
 	}
 	escapedQuery := url.QueryEscape(string(rqJson))
-	reqURL := fmt.Sprintf("%s?%s&request=%s", varusProductsURL, urlParams.Encode(), escapedQuery)
+	reqURL := fmt.Sprintf("%s%s?%s&request=%s", v.BaseURL, varusProductsPath, urlParams.Encode(), escapedQuery)
 	req, err := utils.MakeGetRequest(ctx, reqURL, v.Headers, nil)
 	if err != nil {
 		return nil, fmt.Errorf("[Varus] error making GET Request: %v", err)
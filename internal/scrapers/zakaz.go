@@ -0,0 +1,315 @@
+package scrapers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/httpclient"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/logging"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/models"
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/utils"
+)
+
+const (
+	zakazBaseURL         = "https://stores-api.zakaz.ua"
+	zakazCategoriesPath  = "/stores/%s/categories"
+	zakazProductPageSize = 30
+	zakazSemaphoreSize   = 35
+)
+
+var (
+	zakazRetryPolicy = httpclient.RetryPolicy{MaxAttempts: 5, BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+	zakazRateLimit   = httpclient.RateLimit{RequestsPerSecond: 8, Burst: 16}
+	zakazConcurrency = httpclient.Concurrency{Min: 2, Initial: 8, Max: zakazSemaphoreSize}
+)
+
+// ZakazChain is a retail chain selling through the zakaz.ua platform. StoreID
+// is the store scraped by default; other stores of the chain can be selected
+// through Options.Branches.
+type ZakazChain struct {
+	Code    string
+	Name    string
+	Chain   string
+	StoreID string
+}
+
+// zakazChains are registered as stores of their own. The default store of
+// each chain is one of its Kyiv hypermarkets.
+var zakazChains = []ZakazChain{
+	{Code: "metro", Name: "Metro", Chain: "metro", StoreID: "48215614"},
+	{Code: "novus", Name: "Novus", Chain: "novus", StoreID: "48201070"},
+	{Code: "auchan", Name: "Auchan", Chain: "auchan", StoreID: "48246401"},
+	{Code: "eko", Name: "Eko Market", Chain: "eko", StoreID: "48280214"},
+	{Code: "megamarket", Name: "Megamarket", Chain: "megamarket", StoreID: "48267601"},
+	{Code: "ultramarket", Name: "Ultramarket", Chain: "ultramarket", StoreID: "48277601"},
+	{Code: "tavriav", Name: "Tavria V", Chain: "tavriav", StoreID: "48221130"},
+}
+
+type ZakazScraper struct {
+	Client   *httpclient.Client
+	Headers  map[string]string
+	BaseURL  string
+	Chain    ZakazChain
+	StoreIDs []string
+}
+
+type ZakazCategoryItem struct {
+	Title    string              `json:"title"`
+	Slug     string              `json:"id"`
+	Total    int                 `json:"count"`
+	Children []ZakazCategoryItem `json:"children"`
+}
+
+// ZakazDiscount describes the promotion a product is on, if Status is set.
+// OldPrice is in kopecks like ZakazProduct.Price.
+type ZakazDiscount struct {
+	Status   bool    `json:"status"`
+	OldPrice float64 `json:"old_price"`
+	DueDate  string  `json:"due_date"`
+}
+
+type ZakazProducer struct {
+	Trademark string `json:"trademark"`
+}
+
+// ZakazImages holds the product picture in several sizes.
+type ZakazImages struct {
+	S350 string `json:"s350x350"`
+}
+
+type ZakazProduct struct {
+	Name     string        `json:"title"`
+	Sku      string        `json:"sku"`
+	Price    float64       `json:"price"`
+	Unit     string        `json:"unit"`
+	Ref      string        `json:"web_url"`
+	EAN      string        `json:"ean"`
+	Images   ZakazImages   `json:"img"`
+	Producer ZakazProducer `json:"producer"`
+	Discount ZakazDiscount `json:"discount"`
+	InStock  *bool         `json:"in_stock"`
+}
+
+type ZakazProducts struct {
+	Total int            `json:"count"`
+	Items []ZakazProduct `json:"results"`
+}
+
+func init() {
+	for _, chain := range zakazChains {
+		Register(chain.Code, func(opts Options) (Scraper, error) { return NewZakazScraper(chain, opts), nil })
+	}
+}
+
+func NewZakazScraper(chain ZakazChain, opts Options) *ZakazScraper {
+	storeIDs := opts.Branches[chain.Code]
+	if len(storeIDs) == 0 {
+		storeIDs = []string{chain.StoreID}
+	}
+	return &ZakazScraper{
+		Client: httpclient.New(httpclient.Options{
+			Transport:   opts.Transport,
+			Timeout:     30 * time.Second,
+			Retry:       zakazRetryPolicy,
+			RateLimit:   zakazRateLimit,
+			Concurrency: zakazConcurrency,
+		}),
+		Headers: map[string]string{
+			"Host":             "stores-api.zakaz.ua",
+			"User-Agent":       "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:141.0) Gecko/20100101 Firefox/141.0",
+			"Accept":           "*/*",
+			"Accept-Language":  "uk",
+			"Accept-Encoding":  "utf-8",
+			"Referer":          fmt.Sprintf("https://%s.zakaz.ua/uk/", chain.Chain),
+			"Content-Type":     "application/json",
+			"x-chain":          chain.Chain,
+			"X-Delivery-Type":  "plan",
+			"x-version":        "65",
+			"Origin":           fmt.Sprintf("https://%s.zakaz.ua", chain.Chain),
+			"Sec-GPC":          "1",
+			"Connection":       "keep-alive",
+			"Sec-Fetch-Dest":   "empty",
+			"Sec-Fetch-Mode":   "cors",
+			"Sec-Fetch-Site":   "same-site",
+			"content-language": "uk",
+		},
+		BaseURL:  opts.baseURL(chain.Code, zakazBaseURL),
+		Chain:    chain,
+		StoreIDs: storeIDs,
+	}
+}
+
+func (m *ZakazScraper) Name() string { return m.Chain.Name }
+
+func (m *ZakazScraper) Code() string { return m.Chain.Code }
+
+// GetCategories returns the categories of every scraped store of the chain.
+// Stores whose categories fail to load are reported as failures and skipped;
+// an error is only returned when none of them loaded.
+func (m *ZakazScraper) GetCategories(ctx context.Context) ([]Category, error) {
+	var (
+		categories []Category
+		failed     []string
+		errs       []error
+	)
+	for _, storeID := range m.StoreIDs {
+		cts, err := m.getStoreCategories(ctx, storeID)
+		if err != nil {
+			failed = append(failed, storeID)
+			errs = append(errs, fmt.Errorf("store %s: %w", storeID, err))
+			continue
+		}
+		categories = append(categories, cts...)
+	}
+	if len(failed) > 0 && len(failed) == len(m.StoreIDs) {
+		return nil, errors.Join(errs...)
+	}
+	for i, storeID := range failed {
+		fail(ctx, logging.FromContext(ctx).With("branch", storeID), "error fetching categories", errs[i])
+	}
+	return categories, nil
+}
+
+func (m *ZakazScraper) getStoreCategories(ctx context.Context, storeID string) ([]Category, error) {
+	reqURL := m.BaseURL + fmt.Sprintf(zakazCategoriesPath, storeID)
+	req, err := utils.MakeGetRequest(ctx, reqURL, m.Headers, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("[%s] getting categories: status code %d", m.Chain.Name, resp.StatusCode)
+	}
+
+	readBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var c []ZakazCategoryItem
+	jsonErr := json.Unmarshal(readBody, &c)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+	var categories []Category
+	var total int
+	walkCategoryTree(c,
+		func(v ZakazCategoryItem) (models.CategoryRef, []ZakazCategoryItem) {
+			return models.CategoryRef{Ref: v.Slug, Name: v.Title}, v.Children
+		},
+		func(v ZakazCategoryItem, path []models.CategoryRef) {
+			total += v.Total
+			categories = append(categories, Category{Slug: v.Slug, Name: v.Title, Total: v.Total, Branch: storeID, Path: path})
+		})
+	logging.FromContext(ctx).Info("found categories", "branch", storeID, "categories", len(categories), "products", total)
+	return categories, nil
+}
+
+func (m *ZakazScraper) GetProducts(ctx context.Context, cts []Category, out chan<- models.Product) error {
+	var wg sync.WaitGroup
+	httpSemaphore := make(chan struct{}, zakazSemaphoreSize)
+	for _, ci := range cts {
+		wg.Add(1)
+		numPages := (ci.Total / zakazProductPageSize) + 1
+		go func(ci Category) {
+			defer wg.Done()
+			var pageWg sync.WaitGroup
+			for page := 1; page <= numPages; page++ {
+				pageWg.Add(1)
+				go func(page int) {
+					httpSemaphore <- struct{}{}
+					defer func() { <-httpSemaphore }()
+					defer pageWg.Done()
+					select {
+					case <-ctx.Done():
+						return
+					default:
+					}
+					products, err := m.getProductsFromPage(ctx, ci.Branch, page, ci.Slug)
+					if err != nil {
+						fail(ctx, logging.FromContext(ctx).With("branch", ci.Branch, "category", ci.Slug, "page", page), "error fetching products", err)
+						return
+					}
+					for _, v := range products.Items {
+						regular, promo := v.Price/100, 0.0
+						var promoEndsAt time.Time
+						if v.Discount.Status {
+							regular, promo = promoPrices(v.Price/100, v.Discount.OldPrice/100)
+							promoEndsAt = parsePromoEnd(v.Discount.DueDate)
+						}
+						p := models.Product{
+							Name:         v.Name,
+							ExternalID:   v.Sku,
+							URL:          v.Ref,
+							Brand:        v.Producer.Trademark,
+							SKU:          v.Sku,
+							EAN:          v.EAN,
+							ImageURL:     v.Images.S350,
+							Price:        v.Price / 100,
+							RegularPrice: regular,
+							PromoPrice:   promo,
+							PromoEndsAt:  promoEndsAt,
+							Currency:     "UAH",
+							Unit:         v.Unit,
+							InStock:      v.InStock,
+							CategoryPath: ci.path(),
+							StoreCode:    m.Code(),
+							Branch:       ci.Branch,
+							ScrapedAt:    time.Now(),
+						}
+						setQuantity(&p, v.Unit)
+						out <- p
+					}
+				}(page)
+			}
+			pageWg.Wait()
+		}(ci)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (m *ZakazScraper) getProductsFromPage(ctx context.Context, storeID string, page int, slug string) (*ZakazProducts, error) {
+	p := utils.PrepareURLParams(map[string]string{
+		"page": strconv.Itoa(page),
+	})
+	reqURL := fmt.Sprintf("%s%s/%s/products", m.BaseURL, fmt.Sprintf(zakazCategoriesPath, storeID), slug)
+	req, err := utils.MakeGetRequest(ctx, reqURL, m.Headers, p)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] error making HTTP request: %v", m.Chain.Name, err)
+	}
+	logging.FromContext(ctx).Debug("getting products", "branch", storeID, "category", slug, "page", page, "url", req.URL.String())
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] error getting request: %v", m.Chain.Name, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("[%s] bad status for %s: %s", m.Chain.Name, reqURL, resp.Status)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] error reading response body: %v", m.Chain.Name, err)
+	}
+	var prd ZakazProducts
+	jsonErr := json.Unmarshal(respBody, &prd)
+	if jsonErr != nil {
+		return nil, fmt.Errorf("[%s] error unmarshalling response body: %v", m.Chain.Name, jsonErr)
+	}
+
+	return &prd, nil
+}
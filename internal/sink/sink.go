@@ -0,0 +1,217 @@
+// Package sink writes scraped products out as they are scraped: to CSV or
+// NDJSON files, optionally gzip compressed, or to stdout.
+package sink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrPuls/groceries-price-aggregator-go/internal/models"
+)
+
+// Output formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// gzipExt is appended to the names of compressed files.
+const gzipExt = ".gz"
+
+// Sink receives the products of one store. Write is called from a single
+// goroutine; Close flushes whatever is buffered.
+type Sink interface {
+	Write(p models.Product) error
+	Close() error
+}
+
+// Spec describes one output: the products of every store either go to a file
+// per store in Format, gzip compressed when Gzip is set, or to stdout as
+// NDJSON.
+type Spec struct {
+	Format string
+	Gzip   bool
+	Stdout bool
+}
+
+// ParseSpecs parses a comma separated list of outputs, each one of csv,
+// ndjson, csv.gz, ndjson.gz or stdout, e.g. "csv,ndjson.gz".
+func ParseSpecs(s string) ([]Spec, error) {
+	var specs []Spec
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "stdout" {
+			specs = append(specs, Spec{Format: FormatNDJSON, Stdout: true})
+			continue
+		}
+		format, gz := strings.CutSuffix(entry, gzipExt)
+		if format != FormatCSV && format != FormatNDJSON {
+			return nil, fmt.Errorf("invalid output %q: expected csv, ndjson, csv.gz, ndjson.gz or stdout", entry)
+		}
+		specs = append(specs, Spec{Format: format, Gzip: gz})
+	}
+	for i, spec := range specs {
+		if slices.Contains(specs[:i], spec) {
+			return nil, fmt.Errorf("duplicate output %q", spec)
+		}
+	}
+	return specs, nil
+}
+
+// String returns the spec as accepted by ParseSpecs.
+func (s Spec) String() string {
+	switch {
+	case s.Stdout:
+		return "stdout"
+	case s.Gzip:
+		return s.Format + gzipExt
+	default:
+		return s.Format
+	}
+}
+
+// FileName returns the name, without extension, of the file holding the
+// products of store scraped in the run runID started at startedAt, e.g.
+// "silpo-run42-20261016T033000Z". runID is left out when it is zero.
+func FileName(store string, runID int64, startedAt time.Time) string {
+	name := store
+	if runID != 0 {
+		name += fmt.Sprintf("-run%d", runID)
+	}
+	return name + "-" + startedAt.UTC().Format("20060102T150405Z")
+}
+
+// Open opens the sink for spec. Files are created in dir and named name with
+// the extension of the format.
+func (s Spec) Open(dir, name string) (Sink, error) {
+	if s.Stdout {
+		return &stdoutSink{}, nil
+	}
+	return openFile(filepath.Join(dir, name+"."+s.String()), s.Format, s.Gzip)
+}
+
+// File is implemented by sinks that write to a file.
+type File interface {
+	Path() string
+}
+
+// encoder writes products in one format.
+type encoder interface {
+	encode(p models.Product) error
+	flush() error
+}
+
+func newEncoder(w io.Writer, format string) (encoder, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(models.CSVHeader); err != nil {
+			return nil, err
+		}
+		return csvEncoder{cw}, nil
+	case FormatNDJSON:
+		return ndjsonEncoder{json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+type csvEncoder struct{ w *csv.Writer }
+
+func (e csvEncoder) encode(p models.Product) error { return e.w.Write(p.CSVRecord()) }
+
+func (e csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonEncoder struct{ enc *json.Encoder }
+
+func (e ndjsonEncoder) encode(p models.Product) error { return e.enc.Encode(p) }
+
+func (e ndjsonEncoder) flush() error { return nil }
+
+// fileSink writes to a file, through a gzip writer when compressing.
+type fileSink struct {
+	path     string
+	file     *os.File
+	gz       *gzip.Writer
+	buf      *bufio.Writer
+	enc      encoder
+	products int
+}
+
+func openFile(path, format string, compress bool) (*fileSink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileSink{path: path, file: file}
+	var w io.Writer = file
+	if compress {
+		s.gz = gzip.NewWriter(file)
+		w = s.gz
+	}
+	s.buf = bufio.NewWriter(w)
+	s.enc, err = newEncoder(s.buf, format)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) Path() string { return s.path }
+
+func (s *fileSink) Write(p models.Product) error {
+	s.products++
+	return s.enc.encode(p)
+}
+
+func (s *fileSink) Close() error {
+	err := s.enc.flush()
+	if err == nil {
+		err = s.buf.Flush()
+	}
+	if err == nil && s.gz != nil {
+		err = s.gz.Close()
+	}
+	if cErr := s.file.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", s.path, err)
+	}
+	slog.Info("wrote file", "file", s.path, "products", s.products)
+	return nil
+}
+
+// stdoutMu keeps lines of stores scraped concurrently from interleaving.
+var stdoutMu sync.Mutex
+
+// stdoutSink writes NDJSON to stdout.
+type stdoutSink struct{}
+
+func (stdoutSink) Write(p models.Product) error {
+	line, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	_, err = os.Stdout.Write(append(line, '\n'))
+	return err
+}
+
+func (stdoutSink) Close() error { return nil }